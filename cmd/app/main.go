@@ -1,10 +1,21 @@
 package main
 
 import (
+	"log"
+
+	"github.com/vova4o/go_final_project/internal/config"
 	"github.com/vova4o/go_final_project/internal/server"
 )
 
 func main() {
+	// Check or apply migrations without starting the server
+	if mode := config.Migrate(); mode != "" {
+		if err := server.Migrate(mode); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initialize the server
 	app := server.NewApp()
 
@@ -13,4 +24,4 @@ func main() {
 
 	// Wait for an interrupt signal to shutdown the server
 	app.ShutdownServer(app.NewServer())
-}
\ No newline at end of file
+}
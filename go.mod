@@ -3,6 +3,7 @@ module github.com/vova4o/go_final_project
 go 1.22.1
 
 require (
+	github.com/lib/pq v1.12.3
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.18.2
 )
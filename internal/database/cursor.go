@@ -0,0 +1,124 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+const (
+	// DefaultLimit — число задач на странице списка, если клиент его не указал.
+	DefaultLimit = 10
+	// MaxLimit — наибольшее число задач на одной странице.
+	MaxLimit = 100
+)
+
+// ErrInvalidCursor — курсор страницы повреждён или получен не от этого сервера.
+var ErrInvalidCursor = errors.New("некорректный курсор страницы")
+
+// cursor — ключ задачи, на которой закончилась предыдущая страница. Списки задач упорядочены
+// по дате, времени и id, поэтому следующая страница начинается с задач, чей ключ больше.
+type cursor struct {
+	date string
+	time string
+	id   int64
+}
+
+// rankCursor — ключ задачи, на которой закончилась предыдущая страница результатов полнотекстового поиска:
+// они упорядочены по релевантности (score, чем меньше, тем релевантнее) и id.
+type rankCursor struct {
+	score float64
+	id    int64
+}
+
+// Курсоры разных списков начинаются с вида, чтобы курсор одного списка не приняли за курсор другого.
+const (
+	cursorKind     = "t"
+	rankCursorKind = "r"
+)
+
+// encodeCursor возвращает курсор, указывающий на задачу t.
+func encodeCursor(t models.DBTask) string {
+	return packCursor(cursorKind, t.Date, t.Time, t.ID)
+}
+
+// decodeCursor разбирает курсор, полученный от encodeCursor. Пустая строка означает первую страницу и даёт nil.
+func decodeCursor(s string) (*cursor, error) {
+	parts, err := unpackCursor(s, cursorKind, 3)
+	if parts == nil || err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor{date: parts[0], time: parts[1], id: id}, nil
+}
+
+// encodeRankCursor возвращает курсор, указывающий на задачу id с релевантностью score.
+func encodeRankCursor(score float64, id string) string {
+	return packCursor(rankCursorKind, strconv.FormatFloat(score, 'g', -1, 64), id)
+}
+
+// decodeRankCursor разбирает курсор, полученный от encodeRankCursor. Пустая строка даёт nil.
+func decodeRankCursor(s string) (*rankCursor, error) {
+	parts, err := unpackCursor(s, rankCursorKind, 2)
+	if parts == nil || err != nil {
+		return nil, err
+	}
+	score, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &rankCursor{score: score, id: id}, nil
+}
+
+func packCursor(kind string, parts ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(kind + "|" + strings.Join(parts, "|")))
+}
+
+// unpackCursor возвращает n частей курсора вида kind; для пустого курсора — nil.
+func unpackCursor(s string, kind string, n int) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != n+1 || parts[0] != kind {
+		return nil, ErrInvalidCursor
+	}
+	return parts[1:], nil
+}
+
+// after сообщает, идёт ли задача t в списке после задачи, на которую указывает курсор.
+func (c *cursor) after(t models.DBTask) bool {
+	if t.Date != c.date {
+		return t.Date > c.date
+	}
+	if t.Time != c.time {
+		return t.Time > c.time
+	}
+	id, _ := strconv.ParseInt(t.ID, 10, 64)
+	return id > c.id
+}
+
+// pageLimit возвращает число задач на странице: DefaultLimit, если оно не указано, и не больше MaxLimit.
+func pageLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultLimit
+	case limit > MaxLimit:
+		return MaxLimit
+	}
+	return limit
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver — драйвер SQLite с функцией fold, которая приводит текст к виду foldText.
+const sqliteDriver = "sqlite3_scheduler"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("fold", foldText, true)
+		},
+	})
+}
+
+// dialect описывает различия СУБД, которые Storage учитывает при построении запросов.
+// Запросы пишутся с плейсхолдерами ?, а rebind переписывает их в синтаксис СУБД.
+type dialect struct {
+	driver string
+	// numbered — плейсхолдеры вида $1, $2 вместо ?.
+	numbered bool
+	// autoIncrement — определение столбца id.
+	autoIncrement string
+	// repeatType — тип столбца repeat в первой миграции.
+	repeatType string
+	// alterType — запрос, меняющий у таблицы %s тип столбца %s на %s; пустой, если СУБД не проверяет длину строк.
+	alterType string
+	// fold — выражение, приводящее текст столбца %s к виду, в котором его сравнивает foldText.
+	fold string
+	// tableExists — запрос, проверяющий, есть ли таблица с именем из параметра, columnExists — есть ли в таблице
+	// из первого параметра столбец с именем из второго.
+	tableExists  string
+	columnExists string
+	// migrationLock — запрос, который до конца транзакции блокирует применение миграций другими соединениями.
+	migrationLock string
+}
+
+var sqliteDialect = &dialect{
+	driver:        sqliteDriver,
+	autoIncrement: "INTEGER PRIMARY KEY AUTOINCREMENT",
+	repeatType:    "TEXT(128)",
+	fold:          "fold(%s)",
+	tableExists:   "SELECT exists(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)",
+	columnExists:  "SELECT exists(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)",
+}
+
+var postgresDialect = &dialect{
+	driver:        "postgres",
+	numbered:      true,
+	autoIncrement: "BIGSERIAL PRIMARY KEY",
+	repeatType:    "VARCHAR(128)",
+	alterType:     "ALTER TABLE %s ALTER COLUMN %s TYPE %s",
+	fold:          "translate(lower(%s), 'ё', 'е')",
+	tableExists:   "SELECT exists(SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?)",
+	columnExists:  "SELECT exists(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?)",
+	migrationLock: "SELECT pg_advisory_xact_lock(7540)",
+}
+
+// rebind заменяет плейсхолдеры ? в query на $1, $2… , если СУБД их требует.
+func (d *dialect) rebind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// foldColumn возвращает выражение, приводящее текст столбца column к виду foldText.
+func (d *dialect) foldColumn(column string) string {
+	return fmt.Sprintf(d.fold, column)
+}
+
+// foldText приводит текст к виду, в котором поиск сравнивает его с запросом: к нижнему регистру
+// с учётом кириллицы и с «е» вместо «ё».
+func foldText(s string) string {
+	return strings.NewReplacer("ё", "е").Replace(strings.ToLower(s))
+}
+
+// isPostgresDSN сообщает, указывает ли dsn на базу данных PostgreSQL.
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
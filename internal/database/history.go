@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+// completionColumns — столбцы записи о выполнении в том порядке, в котором их читает completions.
+const completionColumns = "id, task_id, title, date, time, done_at, note"
+
+// newCompletion возвращает запись о выполнении задачи task в момент now с комментарием note.
+func newCompletion(task models.DBTask, now time.Time, note string) models.Completion {
+	return models.Completion{
+		TaskID: task.ID,
+		Title:  task.Title,
+		Date:   task.Date,
+		Time:   task.Time,
+		DoneAt: timestamp(now),
+		Note:   note,
+	}
+}
+
+// TaskHistory возвращает записи о выполнении задачи id по порядку. У задачи, которую ни разу не выполняли
+// или которой нет, история пустая: записи остаются и после удаления задачи.
+func (s *Storage) TaskHistory(ctx context.Context, id string) ([]models.Completion, error) {
+	if !validID(id) {
+		return nil, nil
+	}
+	return s.completions(ctx, "task_id = ?", id)
+}
+
+// History возвращает записи о выполнении всех задач с from по to включительно по порядку.
+// Даты в формате 20060102 — дни выполнения в часовом поясе пользователя; пустая дата не ограничивает интервал.
+func (s *Storage) History(ctx context.Context, from, to string) ([]models.Completion, error) {
+	var conditions []string
+	var args []any
+	if from != "" {
+		conditions = append(conditions, "done_date >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conditions = append(conditions, "done_date <= ?")
+		args = append(args, to)
+	}
+	return s.completions(ctx, strings.Join(conditions, " AND "), args...)
+}
+
+// completions возвращает записи о выполнении, подходящие под условие where, упорядоченные по времени выполнения.
+func (s *Storage) completions(ctx context.Context, where string, args ...any) ([]models.Completion, error) {
+	query := "SELECT " + completionColumns + " FROM completions"
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := s.query(ctx, query+" ORDER BY done_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.Completion
+	for rows.Next() {
+		var c models.Completion
+		if err := rows.Scan(&c.ID, &c.TaskID, &c.Title, &c.Date, &c.Time, &c.DoneAt, &c.Note); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
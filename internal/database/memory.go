@@ -0,0 +1,518 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+// MemoryStorage хранит задачи в памяти процесса и теряет их при остановке.
+// Подходит для демонстрации и тестов: ведёт себя так же, как Storage над SQLite,
+// и безопасен для одновременного использования из нескольких горутин. Исключение — поиск по тексту,
+// см. SearchTasks: он работает как в SQLite без FTS5.
+// Операции выполняются сразу, поэтому контекст проверяется только перед началом операции.
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	tasks  map[int64]models.DBTask
+	trash  map[int64]models.TrashTask
+	lastID int64
+
+	history          []memoryCompletion
+	lastCompletionID int64
+
+	revisions      []models.Revision
+	lastRevisionID int64
+}
+
+// memoryCompletion — запись о выполнении задачи и день выполнения в часовом поясе пользователя.
+type memoryCompletion struct {
+	models.Completion
+	doneDate string
+}
+
+// NewMemory создаёт пустое хранилище задач в памяти.
+func NewMemory() *MemoryStorage {
+	m := &MemoryStorage{}
+	m.InitDB()
+	return m
+}
+
+// InitDB удаляет все задачи из хранилища и корзины и историю выполнения.
+func (m *MemoryStorage) InitDB() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = make(map[int64]models.DBTask)
+	m.trash = make(map[int64]models.TrashTask)
+	m.history = nil
+	m.revisions = nil
+	return nil
+}
+
+// CloseDB ничего не делает: хранилищу в памяти нечего закрывать.
+func (m *MemoryStorage) CloseDB() {}
+
+// AddTaskDB добавляет задачу в хранилище. Возвращает идентификатор задачи.
+// ID задачи не используется.
+func (m *MemoryStorage) AddTaskDB(ctx context.Context, task models.DBTask) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tasks == nil {
+		m.tasks = make(map[int64]models.DBTask)
+	}
+	m.lastID++
+	task.ID = strconv.FormatInt(m.lastID, 10)
+	task.SeriesDate = ""
+	m.tasks[m.lastID] = task
+	return m.lastID, nil
+}
+
+// FindTask ищет задачу по идентификатору ID. Возвращает задачу или ошибку.
+func (m *MemoryStorage) FindTask(ctx context.Context, id string) (models.DBTask, error) {
+	if err := ctx.Err(); err != nil {
+		return models.DBTask{}, err
+	}
+	if id == "" {
+		return models.DBTask{}, errors.New("не указан id задачи")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, ok := m.find(id)
+	if !ok {
+		return models.DBTask{}, errors.New("задача не найдена")
+	}
+	return task, nil
+}
+
+// UpdateTask обновляет задачу и записывает изменение в журнал версий так же, как Storage.UpdateTask.
+// Счётчик выполненных повторений не меняется. Как и UPDATE в SQLite, изменение несуществующей задачи ничего не делает.
+func (m *MemoryStorage) UpdateTask(ctx context.Context, task models.DBTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.update(task); err != nil && !errors.Is(err, ErrTaskNotFound) {
+		return err
+	}
+	return nil
+}
+
+// update обновляет задачу и записывает изменение в журнал версий так же, как Storage.updateTask;
+// вызывается под блокировкой mu.
+func (m *MemoryStorage) update(task models.DBTask) error {
+	old, ok := m.find(task.ID)
+	if !ok {
+		return ErrTaskNotFound
+	}
+	task.ID = old.ID
+	task.DoneCount = max(old.DoneCount, task.DoneCount)
+	task.SeriesDate = seriesDate(old, task)
+
+	changes := taskChanges(old, task)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	logged := false
+	for _, r := range m.revisions {
+		if r.TaskID == task.ID {
+			logged = true
+			break
+		}
+	}
+	if !logged {
+		m.addRevision(models.Revision{TaskID: old.ID, Changes: []models.FieldChange{}, Task: old})
+	}
+	m.store(task)
+	m.addRevision(models.Revision{TaskID: task.ID, ChangedAt: timestamp(time.Now()), Changes: changes, Task: task})
+	return nil
+}
+
+// addRevision добавляет версию в журнал; как и в базе данных, счётчик выполненных повторений и дата серии в версии не хранятся.
+func (m *MemoryStorage) addRevision(r models.Revision) {
+	m.lastRevisionID++
+	r.ID = strconv.FormatInt(m.lastRevisionID, 10)
+	r.Task.DoneCount = 0
+	r.Task.SeriesDate = ""
+	m.revisions = append(m.revisions, r)
+}
+
+// TaskRevisions возвращает версии задачи id по порядку, начиная с исходной.
+func (m *MemoryStorage) TaskRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var revisions []models.Revision
+	for _, r := range m.revisions {
+		if r.TaskID == id {
+			revisions = append(revisions, r)
+		}
+	}
+	return revisions, nil
+}
+
+// RestoreRevision возвращает задачу id к версии revision так же, как Storage.RestoreRevision.
+func (m *MemoryStorage) RestoreRevision(ctx context.Context, id string, revision string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.revisions {
+		if r.ID == revision && r.TaskID == id {
+			return m.update(r.Task)
+		}
+	}
+	return ErrRevisionNotFound
+}
+
+// Tasks возвращает страницу списка задач, упорядоченного по дате и времени.
+func (m *MemoryStorage) Tasks(ctx context.Context, page models.Page) (models.TaskPage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TaskPage{}, err
+	}
+	return m.page(func(models.DBTask) bool { return true }, page)
+}
+
+// SearchTasks возвращает страницу задач, в заголовке или комментарии которых есть подстрока search,
+// упорядоченных по дате и времени. Подстрока сравнивается так же, как в Storage: без учёта регистра и различия «е» и «ё».
+// Так Storage ищет в SQLite без FTS5 и в PostgreSQL; полнотекстового индекса здесь нет, поэтому результаты
+// не упорядочиваются по релевантности и не содержат фрагментов Snippets, как в SQLite с FTS5.
+func (m *MemoryStorage) SearchTasks(ctx context.Context, search string, page models.Page) (models.TaskPage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TaskPage{}, err
+	}
+	pattern := "%" + foldText(search) + "%"
+	return m.page(func(t models.DBTask) bool {
+		return like(foldText(t.Title), pattern) || like(foldText(t.Comment), pattern)
+	}, page)
+}
+
+// TasksByDate возвращает страницу задач на дату date, упорядоченных по времени.
+func (m *MemoryStorage) TasksByDate(ctx context.Context, date string, page models.Page) (models.TaskPage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TaskPage{}, err
+	}
+	return m.page(func(t models.DBTask) bool { return t.Date == date }, page)
+}
+
+// page возвращает страницу задач, для которых match возвращает true, так же, как Storage.taskPage.
+func (m *MemoryStorage) page(match func(models.DBTask) bool, page models.Page) (models.TaskPage, error) {
+	after, err := decodeCursor(page.After)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+	limit := pageLimit(page.Limit)
+
+	tasks := m.sorted(match, byDateTime)
+	result := models.TaskPage{Total: len(tasks)}
+	for _, t := range tasks {
+		if after != nil && !after.after(t) {
+			continue
+		}
+		if len(result.Tasks) == limit {
+			result.NextCursor = encodeCursor(result.Tasks[limit-1])
+			break
+		}
+		result.Tasks = append(result.Tasks, t)
+	}
+	return result, nil
+}
+
+// TasksUntil возвращает все задачи с датой не позже date, упорядоченные по дате и времени.
+func (m *MemoryStorage) TasksUntil(ctx context.Context, date string) ([]models.DBTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.sorted(func(t models.DBTask) bool { return t.Date <= date }, byDateTime), nil
+}
+
+// DoneTask помечает задачу как выполненную и записывает выполнение в историю так же, как Storage.DoneTask.
+func (m *MemoryStorage) DoneTask(ctx context.Context, id string, now time.Time, note string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.find(id)
+	if !ok {
+		return errors.New("задача не найдена")
+	}
+
+	done := newCompletion(task, now, note)
+	keep, err := completeTask(&task, now)
+	if err != nil {
+		return err
+	}
+	m.lastCompletionID++
+	done.ID = strconv.FormatInt(m.lastCompletionID, 10)
+	m.history = append(m.history, memoryCompletion{Completion: done, doneDate: now.Format("20060102")})
+	if !keep {
+		m.remove(task.ID)
+		return nil
+	}
+	m.store(task)
+	return nil
+}
+
+// DeleteTask переносит задачу в корзину. Возвращает ошибку, если задачи нет.
+func (m *MemoryStorage) DeleteTask(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.find(id)
+	if !ok {
+		return errors.New("задача не найдена")
+	}
+	key, _ := strconv.ParseInt(task.ID, 10, 64)
+	if m.trash == nil {
+		m.trash = make(map[int64]models.TrashTask)
+	}
+	m.trash[key] = models.TrashTask{DBTask: task, DeletedAt: timestamp(time.Now())}
+	m.remove(id)
+	return nil
+}
+
+// TrashTasks возвращает задачи из корзины, начиная с удалённых последними.
+func (m *MemoryStorage) TrashTasks(ctx context.Context) ([]models.TrashTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tasks []models.TrashTask
+	for _, t := range m.trash {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].DeletedAt != tasks[j].DeletedAt {
+			return tasks[i].DeletedAt > tasks[j].DeletedAt
+		}
+		idi, _ := strconv.ParseInt(tasks[i].ID, 10, 64)
+		idj, _ := strconv.ParseInt(tasks[j].ID, 10, 64)
+		return idi > idj
+	})
+	return tasks, nil
+}
+
+// RestoreTask возвращает задачу из корзины в список задач с прежним id.
+func (m *MemoryStorage) RestoreTask(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotInTrash
+	}
+	task, ok := m.trash[key]
+	if !ok {
+		return ErrNotInTrash
+	}
+	delete(m.trash, key)
+	m.store(task.DBTask)
+	return nil
+}
+
+// RemoveFromTrash удаляет задачу из корзины навсегда.
+func (m *MemoryStorage) RemoveFromTrash(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return ErrNotInTrash
+	}
+	if _, ok := m.trash[key]; !ok {
+		return ErrNotInTrash
+	}
+	delete(m.trash, key)
+	return nil
+}
+
+// EmptyTrash удаляет навсегда все задачи из корзины. Возвращает число удалённых задач.
+func (m *MemoryStorage) EmptyTrash(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := int64(len(m.trash))
+	m.trash = make(map[int64]models.TrashTask)
+	return n, nil
+}
+
+// PurgeTrash удаляет навсегда задачи, попавшие в корзину раньше before. Возвращает число удалённых задач.
+func (m *MemoryStorage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit := timestamp(before)
+	var n int64
+	for key, t := range m.trash {
+		if t.DeletedAt < limit {
+			delete(m.trash, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// TaskHistory возвращает записи о выполнении задачи id по порядку.
+func (m *MemoryStorage) TaskHistory(ctx context.Context, id string) ([]models.Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.completions(func(c memoryCompletion) bool { return c.TaskID == id }), nil
+}
+
+// History возвращает записи о выполнении всех задач с from по to включительно так же, как Storage.History.
+func (m *MemoryStorage) History(ctx context.Context, from, to string) ([]models.Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.completions(func(c memoryCompletion) bool {
+		return (from == "" || c.doneDate >= from) && (to == "" || c.doneDate <= to)
+	}), nil
+}
+
+// completions возвращает записи о выполнении, для которых match возвращает true, упорядоченные по времени выполнения.
+func (m *MemoryStorage) completions(match func(memoryCompletion) bool) []models.Completion {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var history []models.Completion
+	for _, c := range m.history {
+		if match(c) {
+			history = append(history, c.Completion)
+		}
+	}
+	// Записи добавляются по порядку id, поэтому устойчивая сортировка сохраняет его при равном времени.
+	sort.SliceStable(history, func(i, j int) bool { return history[i].DoneAt < history[j].DoneAt })
+	return history
+}
+
+// find, store и remove работают с задачей по её идентификатору; вызываются под блокировкой mu.
+func (m *MemoryStorage) find(id string) (models.DBTask, bool) {
+	key, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return models.DBTask{}, false
+	}
+	task, ok := m.tasks[key]
+	return task, ok
+}
+
+func (m *MemoryStorage) store(task models.DBTask) {
+	key, _ := strconv.ParseInt(task.ID, 10, 64)
+	m.tasks[key] = task
+}
+
+func (m *MemoryStorage) remove(id string) {
+	key, _ := strconv.ParseInt(id, 10, 64)
+	delete(m.tasks, key)
+}
+
+// byDateTime сравнивает задачи как ORDER BY date, time, id.
+func byDateTime(a, b models.DBTask) bool {
+	if a.Date != b.Date {
+		return a.Date < b.Date
+	}
+	if a.Time != b.Time {
+		return a.Time < b.Time
+	}
+	ida, _ := strconv.ParseInt(a.ID, 10, 64)
+	idb, _ := strconv.ParseInt(b.ID, 10, 64)
+	return ida < idb
+}
+
+// sorted возвращает копии задач, для которых match возвращает true, упорядоченные по less.
+// Как и запрос без подходящих строк, при отсутствии таких задач возвращает nil.
+func (m *MemoryStorage) sorted(match func(models.DBTask) bool, less func(a, b models.DBTask) bool) []models.DBTask {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tasks []models.DBTask
+	for _, t := range m.tasks {
+		if match(t) {
+			tasks = append(tasks, t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return less(tasks[i], tasks[j]) })
+	return tasks
+}
+
+// like сообщает, подходит ли s под шаблон pattern оператора LIKE SQLite: % — любая
+// последовательность символов, _ — один любой символ, регистр не учитывается только у латинских букв.
+func like(s string, pattern string) bool {
+	str, pat := []rune(s), []rune(pattern)
+	// Жадное сопоставление с возвратом к последнему %.
+	i, j := 0, 0
+	star, mark := -1, 0
+	for i < len(str) {
+		switch {
+		case j < len(pat) && pat[j] == '%':
+			star, mark = j, i
+			j++
+		case j < len(pat) && (pat[j] == '_' || foldASCII(pat[j]) == foldASCII(str[i])):
+			i++
+			j++
+		case star >= 0:
+			mark++
+			i, j = mark, star+1
+		default:
+			return false
+		}
+	}
+	for j < len(pat) && pat[j] == '%' {
+		j++
+	}
+	return j == len(pat)
+}
+
+func foldASCII(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
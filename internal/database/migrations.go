@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migration — одно изменение схемы базы данных. Миграции применяются по возрастанию version,
+// каждая в своей транзакции, и записываются в таблицу schema_migrations.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx, d *dialect) error
+}
+
+// MigrationState — миграция и признак того, что она уже применена к базе данных.
+type MigrationState struct {
+	Version int
+	Name    string
+	Applied bool
+}
+
+// migrations — все миграции схемы по порядку. Уже выпущенные миграции не меняются,
+// новое изменение схемы добавляется в конец списка со следующим номером.
+var migrations = []migration{
+	{1, "create scheduler", func(tx *sql.Tx, d *dialect) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS scheduler (
+			id ` + d.autoIncrement + `,
+			date TEXT NOT NULL,
+			title TEXT NOT NULL,
+			comment TEXT,
+			repeat ` + d.repeatType + `
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS indexdate ON scheduler (date)`)
+		return err
+	}},
+	{2, "task time", func(tx *sql.Tx, d *dialect) error {
+		return addColumn(tx, d, "time", "TEXT NOT NULL DEFAULT ''")
+	}},
+	{3, "repeat anchor", func(tx *sql.Tx, d *dialect) error {
+		return addColumn(tx, d, "anchor", "TEXT NOT NULL DEFAULT 'schedule'")
+	}},
+	{4, "repeat end", func(tx *sql.Tx, d *dialect) error {
+		if err := addColumn(tx, d, "end_date", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		if err := addColumn(tx, d, "max_count", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		return addColumn(tx, d, "done_count", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{5, "trash", func(tx *sql.Tx, d *dialect) error {
+		// Удалённые задачи хранятся отдельно от scheduler с прежним id и временем удаления в формате RFC 3339 (UTC).
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS trash (
+			id BIGINT PRIMARY KEY,
+			date TEXT NOT NULL,
+			time TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL,
+			comment TEXT,
+			repeat VARCHAR(128),
+			anchor TEXT NOT NULL DEFAULT 'schedule',
+			end_date TEXT NOT NULL DEFAULT '',
+			max_count INTEGER NOT NULL DEFAULT 0,
+			done_count INTEGER NOT NULL DEFAULT 0,
+			deleted_at TEXT NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS indexdeleted ON trash (deleted_at)`)
+		return err
+	}},
+	{6, "completions", func(tx *sql.Tx, d *dialect) error {
+		// done_at — время выполнения в формате RFC 3339 (UTC), done_date — день выполнения в часовом поясе пользователя.
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS completions (
+			id ` + d.autoIncrement + `,
+			task_id BIGINT NOT NULL,
+			title TEXT NOT NULL,
+			date TEXT NOT NULL,
+			time TEXT NOT NULL DEFAULT '',
+			done_at TEXT NOT NULL,
+			done_date TEXT NOT NULL,
+			note TEXT NOT NULL DEFAULT ''
+		)`)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS indexcompletiontask ON completions (task_id)`); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS indexcompletiondate ON completions (done_date)`)
+		return err
+	}},
+	{7, "revisions", func(tx *sql.Tx, d *dialect) error {
+		// changes — изменённые поля в JSON, остальные столбцы — задача после изменения.
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS revisions (
+			id ` + d.autoIncrement + `,
+			task_id BIGINT NOT NULL,
+			changed_at TEXT NOT NULL,
+			changes TEXT NOT NULL,
+			date TEXT NOT NULL,
+			time TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL,
+			comment TEXT,
+			repeat VARCHAR(128),
+			anchor TEXT NOT NULL DEFAULT 'schedule',
+			end_date TEXT NOT NULL DEFAULT '',
+			max_count INTEGER NOT NULL DEFAULT 0
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS indexrevisiontask ON revisions (task_id)`)
+		return err
+	}},
+	{8, "series date", func(tx *sql.Tx, d *dialect) error {
+		// Дата серии переносится в корзину и обратно вместе с задачей.
+		for _, table := range []string{"scheduler", "trash"} {
+			if err := addTableColumn(tx, d, table, "series_date", "TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{9, "long repeat", func(tx *sql.Tx, d *dialect) error {
+		// Правила RRULE бывают длиннее 128 символов. SQLite длину строк не проверяет.
+		if d.alterType == "" {
+			return nil
+		}
+		for _, table := range []string{"scheduler", "trash", "revisions"} {
+			if _, err := tx.Exec(fmt.Sprintf(d.alterType, table, "repeat", "TEXT")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// addColumn добавляет в таблицу scheduler столбец name, если его там нет.
+// В базах, обновлённых до появления миграций, часть столбцов уже может быть.
+func addColumn(tx *sql.Tx, d *dialect, name string, definition string) error {
+	return addTableColumn(tx, d, "scheduler", name, definition)
+}
+
+// addTableColumn добавляет в таблицу table столбец name, если его там нет.
+func addTableColumn(tx *sql.Tx, d *dialect, table string, name string, definition string) error {
+	var exists bool
+	err := tx.QueryRow(d.rebind(d.columnExists), table, name).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, name, definition))
+	return err
+}
+
+// Migrations возвращает все миграции схемы с отметкой, применена ли каждая из них.
+func (s *Storage) Migrations() ([]MigrationState, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		states = append(states, MigrationState{Version: m.version, Name: m.name, Applied: applied[m.version]})
+	}
+	return states, nil
+}
+
+// Migrate применяет к базе данных все ещё не применённые миграции по порядку.
+// Если миграция завершилась ошибкой, её изменения откатываются, а следующие миграции не применяются.
+// Несколько экземпляров приложения с общей базой PostgreSQL применяют миграции по очереди.
+func (s *Storage) Migrate() error {
+	err := s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)`)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := s.apply(m); err != nil {
+			return fmt.Errorf("миграция %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// appliedMigrations возвращает номера применённых миграций и не меняет базу данных:
+// если таблицы schema_migrations ещё нет, ни одна миграция не применена.
+func (s *Storage) appliedMigrations() (map[int]bool, error) {
+	var exists bool
+	err := s.queryRow(context.Background(), s.syntax().tableExists, "schema_migrations").Scan(&exists)
+	if err != nil || !exists {
+		return map[int]bool{}, err
+	}
+
+	rows, err := s.query(context.Background(), "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// apply применяет миграцию m и записывает её номер в schema_migrations в одной транзакции.
+// Миграцию, которую уже применил другой экземпляр приложения, apply пропускает.
+func (s *Storage) apply(m migration) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		d := s.syntax()
+		var done bool
+		err := tx.QueryRow(d.rebind("SELECT exists(SELECT 1 FROM schema_migrations WHERE version = ?)"), m.version).Scan(&done)
+		if err != nil || done {
+			return err
+		}
+
+		if err := m.up(tx, d); err != nil {
+			return err
+		}
+		_, err = tx.Exec(d.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+			m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		log.Printf("Migration %d applied: %s\n", m.version, m.name)
+		return nil
+	})
+}
+
+// inTx выполняет f в транзакции, которая откатывается, если f вернула ошибку.
+// В PostgreSQL транзакция сначала берёт блокировку миграций, чтобы экземпляры приложения не меняли схему одновременно.
+func (s *Storage) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if lock := s.syntax().migrationLock; lock != "" {
+		if _, err := tx.Exec(lock); err != nil {
+			return err
+		}
+	}
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
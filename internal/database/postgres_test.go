@@ -0,0 +1,132 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// postgresDSN — DSN базы PostgreSQL для проверок: из postgresEnv или локального сервера, запущенного TestMain.
+var postgresDSN string
+
+// postgresErr — почему PostgreSQL для проверок недоступен. errPostgresMissing означает, что его нет на машине,
+// остальные ошибки — что найденный сервер не удалось запустить.
+var postgresErr error
+
+var errPostgresMissing = errors.New("pg_ctl не найден ни в PATH, ни в /usr/lib/postgresql/*/bin")
+
+func TestMain(m *testing.M) {
+	stop := setupPostgres()
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// setupPostgres готовит базу PostgreSQL для проверок: берёт DSN из postgresEnv, а если он не задан,
+// запускает временный сервер из initdb и pg_ctl. Возвращает функцию, которая останавливает сервер.
+func setupPostgres() func() {
+	if dsn := os.Getenv(postgresEnv); dsn != "" {
+		postgresDSN = dsn
+		return func() {}
+	}
+
+	bin, err := postgresBin()
+	if err != nil {
+		postgresErr = err
+		fmt.Fprintf(os.Stderr, "\n*** PostgreSQL недоступен, проверки на нём пропускаются: %v.\n"+
+			"*** Установите PostgreSQL или задайте DSN тестовой базы в %s.\n\n", err, postgresEnv)
+		return func() {}
+	}
+
+	dsn, stop, err := startPostgres(bin)
+	if err != nil {
+		postgresErr = fmt.Errorf("не удалось запустить PostgreSQL из %s: %w", bin, err)
+		return func() {}
+	}
+	postgresDSN = dsn
+	return stop
+}
+
+// postgresBin возвращает каталог с initdb и pg_ctl.
+func postgresBin() (string, error) {
+	if path, err := exec.LookPath("pg_ctl"); err == nil {
+		return filepath.Dir(path), nil
+	}
+	// В Debian и Ubuntu программы сервера не лежат в PATH; берётся самая новая версия.
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	sort.Slice(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j]) || len(dirs[i]) == len(dirs[j]) && dirs[i] > dirs[j]
+	})
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "pg_ctl")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", errPostgresMissing
+}
+
+// startPostgres создаёт во временном каталоге кластер PostgreSQL и запускает его на свободном порту.
+// Возвращает DSN базы postgres и функцию, которая останавливает сервер и удаляет каталог.
+func startPostgres(bin string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "scheduler-postgres-")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+	logFile := filepath.Join(dir, "postgres.log")
+
+	// Кодировка и локаль UTF-8 нужны, чтобы lower() в поиске приводил к нижнему регистру и кириллицу.
+	err = run(filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--locale=C.UTF-8", "--no-sync")
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -F", port, dir)
+	err = run(filepath.Join(bin, "pg_ctl"), "-D", data, "-l", logFile, "-o", options, "-w", "start")
+	if err != nil {
+		if log, readErr := os.ReadFile(logFile); readErr == nil {
+			err = fmt.Errorf("%w\n%s", err, log)
+		}
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	stop := func() {
+		if err := run(filepath.Join(bin, "pg_ctl"), "-D", data, "-m", "immediate", "-w", "stop"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.RemoveAll(dir)
+	}
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port), stop, nil
+}
+
+// run выполняет программу и возвращает её вывод в ошибке, если она завершилась неудачно.
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w\n%s", filepath.Base(name), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// freePort возвращает свободный TCP-порт на 127.0.0.1.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+var (
+	// ErrTaskNotFound — задачи с таким id нет в списке задач.
+	ErrTaskNotFound = errors.New("задача не найдена")
+	// ErrRevisionNotFound — у задачи нет версии с таким id.
+	ErrRevisionNotFound = errors.New("версия задачи не найдена")
+)
+
+// revisionColumns — столбцы версии задачи в том порядке, в котором их читает revisionFields.
+const revisionColumns = "id, task_id, changed_at, changes, date, time, title, comment, repeat, anchor, end_date, max_count"
+
+// taskChanges возвращает поля, которыми задача task отличается от old. Счётчик выполненных повторений не сравнивается:
+// UpdateTask его не меняет.
+func taskChanges(old, task models.DBTask) []models.FieldChange {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"date", old.Date, task.Date},
+		{"time", old.Time, task.Time},
+		{"title", old.Title, task.Title},
+		{"comment", old.Comment, task.Comment},
+		{"repeat", old.Repeat, task.Repeat},
+		{"anchor", old.Anchor, task.Anchor},
+		{"end_date", old.EndDate, task.EndDate},
+		{"max_count", strconv.Itoa(old.MaxCount), strconv.Itoa(task.MaxCount)},
+	}
+	var changes []models.FieldChange
+	for _, f := range fields {
+		if f.old != f.new {
+			changes = append(changes, models.FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+// seriesDate возвращает дату серии задачи task, изменённой из old: дата до переноса на рабочий день
+// остаётся, только пока не меняются дата задачи и правило повторения.
+func seriesDate(old, task models.DBTask) string {
+	if task.Date != old.Date || task.Repeat != old.Repeat || task.Anchor != old.Anchor {
+		return ""
+	}
+	return old.SeriesDate
+}
+
+// updateTask обновляет задачу в транзакции tx и записывает изменение в журнал версий. Перед первым изменением
+// в журнал записывается исходная версия задачи, чтобы к ней тоже можно было вернуться. Если задача не изменилась,
+// ничего не записывается. Счётчик выполненных повторений не уменьшается: он растёт, только когда при изменении
+// дату задачи переносят из прошлого. Если задачи нет, возвращает ErrTaskNotFound.
+func (s *Storage) updateTask(ctx context.Context, tx *sql.Tx, task models.DBTask) error {
+	if !validID(task.ID) {
+		return ErrTaskNotFound
+	}
+	d := s.syntax()
+	var old models.DBTask
+	err := tx.QueryRowContext(ctx, d.rebind("SELECT "+taskColumns+" FROM scheduler WHERE id = ?"), task.ID).Scan(taskFields(&old)...)
+	if err == sql.ErrNoRows {
+		return ErrTaskNotFound
+	}
+	if err != nil {
+		return err
+	}
+	task.ID = old.ID
+	task.DoneCount = max(old.DoneCount, task.DoneCount)
+	task.SeriesDate = seriesDate(old, task)
+
+	changes := taskChanges(old, task)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var logged bool
+	err = tx.QueryRowContext(ctx, d.rebind("SELECT exists(SELECT 1 FROM revisions WHERE task_id = ?)"), task.ID).Scan(&logged)
+	if err != nil {
+		return err
+	}
+	if !logged {
+		if err := s.addRevision(ctx, tx, models.Revision{TaskID: old.ID, Task: old}); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE scheduler SET date = ?, time = ?, title = ?, comment = ?, repeat = ?, anchor = ?, end_date = ?, max_count = ?, done_count = ?,
+		series_date = ? WHERE id = ?`
+	_, err = tx.ExecContext(ctx, d.rebind(query), task.Date, task.Time, task.Title, task.Comment, task.Repeat, task.Anchor, task.EndDate, task.MaxCount,
+		task.DoneCount, task.SeriesDate, task.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.addRevision(ctx, tx, models.Revision{TaskID: task.ID, ChangedAt: timestamp(time.Now()), Changes: changes, Task: task})
+}
+
+func (s *Storage) addRevision(ctx context.Context, tx *sql.Tx, r models.Revision) error {
+	changes, err := marshalChanges(r.Changes)
+	if err != nil {
+		return err
+	}
+	t := r.Task
+	_, err = tx.ExecContext(ctx, s.syntax().rebind(`INSERT INTO revisions (task_id, changed_at, changes, date, time, title, comment, repeat, anchor, end_date, max_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		r.TaskID, r.ChangedAt, changes, t.Date, t.Time, t.Title, t.Comment, t.Repeat, t.Anchor, t.EndDate, t.MaxCount)
+	return err
+}
+
+// TaskRevisions возвращает версии задачи id по порядку, начиная с исходной. У задачи, которую не меняли, версий нет.
+func (s *Storage) TaskRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	if !validID(id) {
+		return nil, nil
+	}
+	rows, err := s.query(ctx, "SELECT "+revisionColumns+" FROM revisions WHERE task_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.Revision
+	for rows.Next() {
+		var r models.Revision
+		var changes string
+		if err := rows.Scan(revisionFields(&r, &changes)...); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &r.Changes); err != nil {
+			return nil, err
+		}
+		r.Task.ID = r.TaskID
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// RestoreRevision возвращает задачу id к версии revision. Восстановление записывается в журнал как новая версия.
+// Если у задачи нет такой версии, возвращает ErrRevisionNotFound, а если задачи нет — ErrTaskNotFound.
+func (s *Storage) RestoreRevision(ctx context.Context, id string, revision string) error {
+	if !validID(id) || !validID(revision) {
+		return ErrRevisionNotFound
+	}
+	return s.inTxContext(ctx, func(tx *sql.Tx) error {
+		var r models.Revision
+		var changes string
+		err := tx.QueryRowContext(ctx, s.syntax().rebind("SELECT "+revisionColumns+" FROM revisions WHERE id = ? AND task_id = ?"), revision, id).
+			Scan(revisionFields(&r, &changes)...)
+		if err == sql.ErrNoRows {
+			return ErrRevisionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		r.Task.ID = r.TaskID
+		return s.updateTask(ctx, tx, r.Task)
+	})
+}
+
+// revisionFields возвращает указатели на поля версии в порядке столбцов revisionColumns; изменения читаются в changes.
+func revisionFields(r *models.Revision, changes *string) []any {
+	t := &r.Task
+	return []any{&r.ID, &r.TaskID, &r.ChangedAt, changes, &t.Date, &t.Time, &t.Title, &t.Comment, &t.Repeat, &t.Anchor, &t.EndDate, &t.MaxCount}
+}
+
+// marshalChanges возвращает изменения в JSON; у исходной версии это пустой массив.
+func marshalChanges(changes []models.FieldChange) (string, error) {
+	if changes == nil {
+		changes = []models.FieldChange{}
+	}
+	data, err := json.Marshal(changes)
+	return string(data), err
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+// Полнотекстовый индекс задач — таблица FTS5 scheduler_fts над столбцами title и comment таблицы scheduler.
+// Триггеры обновляют индекс при каждом изменении задач. Индекс можно в любой момент пересобрать
+// из таблицы scheduler, поэтому он создаётся при запуске, а не миграцией: FTS5 есть в SQLite, только
+// если приложение собрано с тегом sqlite_fts5, а без индекса поиск работает через LIKE.
+// Регистр букв, в том числе кириллических, токенизатор не учитывает сам, а «ё» заменяется на «е»
+// встроенной функцией replace, чтобы триггеры работали и в соединениях без функции fold.
+const searchTable = `CREATE VIRTUAL TABLE IF NOT EXISTS scheduler_fts USING fts5(
+	title, comment, content = 'scheduler', content_rowid = 'id', tokenize = 'unicode61 remove_diacritics 2'
+)`
+
+// searchText возвращает выражение, приводящее текст столбца column к виду, в котором он попадает в индекс.
+func searchText(column string) string {
+	return "replace(replace(" + column + ", 'ё', 'е'), 'Ё', 'Е')"
+}
+
+// searchTriggers — триггеры индекса по именам. При запуске индекс пересобирается, если текст
+// какого-нибудь триггера в базе отличается от этого, например в базе, созданной прежней версией.
+var searchTriggers = []struct {
+	name string
+	sql  string
+}{
+	{"scheduler_fts_insert", `CREATE TRIGGER scheduler_fts_insert AFTER INSERT ON scheduler BEGIN
+	INSERT INTO scheduler_fts (rowid, title, comment) VALUES (new.id, ` + searchText("new.title") + `, ` + searchText("new.comment") + `);
+END`},
+	{"scheduler_fts_delete", `CREATE TRIGGER scheduler_fts_delete AFTER DELETE ON scheduler BEGIN
+	INSERT INTO scheduler_fts (scheduler_fts, rowid, title, comment) VALUES ('delete', old.id, ` + searchText("old.title") + `, ` + searchText("old.comment") + `);
+END`},
+	{"scheduler_fts_update", `CREATE TRIGGER scheduler_fts_update AFTER UPDATE OF title, comment ON scheduler BEGIN
+	INSERT INTO scheduler_fts (scheduler_fts, rowid, title, comment) VALUES ('delete', old.id, ` + searchText("old.title") + `, ` + searchText("old.comment") + `);
+	INSERT INTO scheduler_fts (rowid, title, comment) VALUES (new.id, ` + searchText("new.title") + `, ` + searchText("new.comment") + `);
+END`},
+}
+
+// searchRebuild заново заполняет индекс задачами из таблицы scheduler.
+var searchRebuild = []string{
+	`INSERT INTO scheduler_fts (scheduler_fts) VALUES ('delete-all')`,
+	`INSERT INTO scheduler_fts (rowid, title, comment) SELECT id, ` + searchText("title") + `, ` + searchText("comment") + ` FROM scheduler`,
+}
+
+// Маркеры, которыми snippet выделяет найденные слова; после экранирования HTML они заменяются на <mark>.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// initSearch подключает полнотекстовый поиск, если база данных — SQLite с FTS5. Индекс создаётся
+// и заполняется, если его ещё нет или его триггеры отличаются от searchTriggers. Если FTS5 нет, триггеры индекса удаляются,
+// иначе изменение задач требовало бы недоступного модуля, и поиск работает через LIKE.
+func (s *Storage) initSearch() error {
+	s.fts = false
+	if s.syntax() != sqliteDialect {
+		return nil
+	}
+
+	var available bool
+	err := s.Db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !available {
+		if err := dropSearchTriggers(tx); err != nil {
+			return err
+		}
+		log.Println("SQLite is built without FTS5, search uses LIKE")
+		return tx.Commit()
+	}
+
+	current := 0
+	for _, trigger := range searchTriggers {
+		var same bool
+		err := tx.QueryRow("SELECT exists(SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = ? AND sql = ?)", trigger.name, trigger.sql).Scan(&same)
+		if err != nil {
+			return err
+		}
+		if same {
+			current++
+		}
+	}
+	if current != len(searchTriggers) {
+		if err := dropSearchTriggers(tx); err != nil {
+			return err
+		}
+		statements := []string{searchTable}
+		for _, trigger := range searchTriggers {
+			statements = append(statements, trigger.sql)
+		}
+		for _, statement := range append(statements, searchRebuild...) {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		log.Println("Full-text search index built")
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.fts = true
+	return nil
+}
+
+func dropSearchTriggers(tx *sql.Tx) error {
+	for _, trigger := range searchTriggers {
+		if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + trigger.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ftsQuery переводит поисковую строку в запрос FTS5: слова ищутся все сразу, текст в кавычках — как фраза,
+// а слово или фраза со звёздочкой на конце — как префикс ("купить молоко", молок*).
+// Остальной синтаксис FTS5 (AND, OR, NOT, столбцы) не поддерживается: такие слова ищутся как обычные.
+func ftsQuery(search string) string {
+	var terms []string
+	add := func(term string, prefix bool) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return
+		}
+		term = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	rest := search
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if rest == "" {
+			break
+		}
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				// Незакрытая кавычка: фраза продолжается до конца строки.
+				add(rest[1:], false)
+				break
+			}
+			phrase := rest[1 : end+1]
+			rest = rest[end+2:]
+			prefix := strings.HasPrefix(rest, "*")
+			if prefix {
+				rest = rest[1:]
+			}
+			add(phrase, prefix)
+			continue
+		}
+		end := strings.IndexAny(rest, " \t\r\n")
+		if end < 0 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+		prefix := strings.HasSuffix(word, "*")
+		add(strings.TrimRight(word, "*"), prefix)
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchRanked возвращает страницу задач, найденных по индексу запросом FTS5 match, упорядоченных
+// по релевантности: совпадение в заголовке весит больше, чем в комментарии. У каждой задачи есть
+// фрагмент текста с найденными словами, выделенными тегом <mark>; остальной текст фрагмента экранирован для HTML.
+func (s *Storage) searchRanked(ctx context.Context, match string, page models.Page) (models.TaskPage, error) {
+	after, err := decodeRankCursor(page.After)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+	limit := pageLimit(page.Limit)
+
+	var result models.TaskPage
+	err = s.queryRow(ctx, "SELECT count(*) FROM scheduler_fts WHERE scheduler_fts MATCH ?", match).Scan(&result.Total)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
+	query := `SELECT ` + taskColumns + `, score, snip FROM (
+		SELECT s.` + strings.ReplaceAll(taskColumns, ", ", ", s.") + `,
+			bm25(scheduler_fts, 10.0, 1.0) AS score,
+			snippet(scheduler_fts, -1, '` + markStart + `', '` + markEnd + `', '…', 12) AS snip
+		FROM scheduler_fts JOIN scheduler s ON s.id = scheduler_fts.rowid
+		WHERE scheduler_fts MATCH ?
+	)`
+	args := []any{match}
+	if after != nil {
+		query += " WHERE (score, id) > (?, ?)"
+		args = append(args, after.score, after.id)
+	}
+	// Лишняя задача показывает, что за страницей есть следующая.
+	query += " ORDER BY score, id LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+	defer rows.Close()
+
+	var scores []float64
+	for rows.Next() {
+		var t models.DBTask
+		var score float64
+		var snip sql.NullString
+		if err := rows.Scan(append(taskFields(&t), &score, &snip)...); err != nil {
+			return models.TaskPage{}, err
+		}
+		result.Tasks = append(result.Tasks, t)
+		result.Snippets = append(result.Snippets, highlight(snip.String))
+		scores = append(scores, score)
+	}
+	if err := rows.Err(); err != nil {
+		return models.TaskPage{}, err
+	}
+
+	if len(result.Tasks) > limit {
+		result.Tasks = result.Tasks[:limit]
+		result.Snippets = result.Snippets[:limit]
+		result.NextCursor = encodeRankCursor(scores[limit-1], result.Tasks[limit-1].ID)
+	}
+	return result, nil
+}
+
+// highlight экранирует фрагмент для HTML и заменяет маркеры найденных слов на теги <mark>.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(snippet)
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+func TestFtsQuery(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"молоко", `"молоко"`},
+		{"  купить   молоко ", `"купить" "молоко"`},
+		{"молок*", `"молок"*`},
+		{`"купить молоко"`, `"купить молоко"`},
+		{`"купить мол"* хлеб`, `"купить мол"* "хлеб"`},
+		{`"без конца`, `"без конца"`},
+		{`a"b OR c`, `"a""b" "OR" "c"`},
+		{"* \"\" ", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ftsQuery(tt.search), tt.search)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "&lt;b&gt; &amp; <mark>молоко</mark>…", highlight("<b> & "+markStart+"молоко"+markEnd+"…"))
+}
+
+// ftsStorage возвращает SQLite в памяти с полнотекстовым индексом или пропускает тест,
+// если приложение собрано без тега sqlite_fts5.
+func ftsStorage(t *testing.T) *Storage {
+	s := sqliteStorage(t)
+	require.NoError(t, s.Migrate())
+	require.NoError(t, s.initSearch())
+	if !s.fts {
+		t.Skip("SQLite собран без FTS5, нужен тег sqlite_fts5")
+	}
+	return s
+}
+
+func TestSearchRanked(t *testing.T) {
+	ctx := context.Background()
+	s := ftsStorage(t)
+	comment := addTask(t, s, models.DBTask{Date: "20240201", Title: "Магазин", Comment: "купить молоко и хлеб"})
+	title := addTask(t, s, models.DBTask{Date: "20240202", Title: "Молоко <свежее>"})
+	addTask(t, s, models.DBTask{Date: "20240203", Title: "Молочная каша"})
+
+	page, err := s.SearchTasks(ctx, "молоко", models.Page{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	require.Len(t, page.Tasks, 2)
+	// Совпадение в заголовке релевантнее, чем в комментарии.
+	assert.Equal(t, title, page.Tasks[0].ID)
+	assert.Equal(t, comment, page.Tasks[1].ID)
+	assert.Equal(t, []string{"<mark>Молоко</mark> &lt;свежее&gt;", "купить <mark>молоко</mark> и хлеб"}, page.Snippets)
+
+	page, err = s.SearchTasks(ctx, "мол*", models.Page{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+
+	page, err = s.SearchTasks(ctx, `"молоко и хлеб"`, models.Page{})
+	require.NoError(t, err)
+	require.Len(t, page.Tasks, 1)
+	assert.Equal(t, comment, page.Tasks[0].ID)
+
+	page, err = s.SearchTasks(ctx, `"хлеб и молоко"`, models.Page{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Tasks)
+
+	yo := addTask(t, s, models.DBTask{Date: "20240204", Title: "Нарядить Ёлку"})
+	for _, search := range []string{"елку", "ЁЛКУ", "нарядить ёл*"} {
+		page, err = s.SearchTasks(ctx, search, models.Page{})
+		require.NoError(t, err)
+		require.Len(t, page.Tasks, 1, search)
+		assert.Equal(t, yo, page.Tasks[0].ID, search)
+		// Фрагмент показывает исходный текст задачи.
+		assert.Contains(t, page.Snippets[0], "Ёлку</mark>", search)
+	}
+}
+
+// TestSearchIndexForeignConnection проверяет, что задачи можно менять и через соединение
+// обычного драйвера SQLite, в котором нет функции fold, например из тестов API.
+func TestSearchIndexForeignConnection(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "scheduler.db")
+	db, err := sql.Open(sqliteDriver, file)
+	require.NoError(t, err)
+	defer db.Close()
+	s := &Storage{Db: db, dialect: sqliteDialect}
+	require.NoError(t, s.Migrate())
+	require.NoError(t, s.initSearch())
+	if !s.fts {
+		t.Skip("SQLite собран без FTS5, нужен тег sqlite_fts5")
+	}
+
+	foreign, err := sql.Open("sqlite3", file)
+	require.NoError(t, err)
+	defer foreign.Close()
+	_, err = foreign.Exec("INSERT INTO scheduler (date, title, comment, repeat) VALUES ('20240201', 'Ёлка', '', '')")
+	require.NoError(t, err)
+
+	page, err := s.SearchTasks(context.Background(), "елка", models.Page{})
+	require.NoError(t, err)
+	assert.Len(t, page.Tasks, 1)
+
+	_, err = foreign.Exec("DELETE FROM scheduler")
+	require.NoError(t, err)
+	page, err = s.SearchTasks(context.Background(), "елка", models.Page{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Tasks)
+}
+
+func TestSearchIndexSync(t *testing.T) {
+	ctx := context.Background()
+	s := ftsStorage(t)
+	id := addTask(t, s, models.DBTask{Date: "20240201", Title: "Позвонить маме"})
+
+	task, err := s.FindTask(ctx, id)
+	require.NoError(t, err)
+	task.Title = "Написать бабушке"
+	require.NoError(t, s.UpdateTask(ctx, task))
+
+	page, err := s.SearchTasks(ctx, "маме", models.Page{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Tasks)
+	page, err = s.SearchTasks(ctx, "бабушке", models.Page{})
+	require.NoError(t, err)
+	assert.Len(t, page.Tasks, 1)
+
+	require.NoError(t, s.DeleteTask(ctx, id))
+	page, err = s.SearchTasks(ctx, "бабушке", models.Page{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Tasks)
+	assert.Zero(t, page.Total)
+
+	// Задача, восстановленная из корзины, снова находится.
+	require.NoError(t, s.RestoreTask(ctx, id))
+	page, err = s.SearchTasks(ctx, "бабушке", models.Page{})
+	require.NoError(t, err)
+	assert.Len(t, page.Tasks, 1)
+}
+
+func TestSearchIndexRebuild(t *testing.T) {
+	ctx := context.Background()
+	s := sqliteStorage(t)
+	require.NoError(t, s.Migrate())
+	// Задачи, добавленные до появления индекса, попадают в него при запуске.
+	addTask(t, s, models.DBTask{Date: "20240201", Title: "Старая задача"})
+	require.NoError(t, s.initSearch())
+	if !s.fts {
+		t.Skip("SQLite собран без FTS5, нужен тег sqlite_fts5")
+	}
+
+	page, err := s.SearchTasks(ctx, "старая", models.Page{})
+	require.NoError(t, err)
+	assert.Len(t, page.Tasks, 1)
+
+	// Повторный запуск не пересоздаёт готовый индекс.
+	require.NoError(t, s.initSearch())
+	page, err = s.SearchTasks(ctx, "старая", models.Page{})
+	require.NoError(t, err)
+	assert.Len(t, page.Tasks, 1)
+}
+
+func TestSearchRankedPages(t *testing.T) {
+	ctx := context.Background()
+	s := ftsStorage(t)
+	for i := 0; i < 5; i++ {
+		addTask(t, s, models.DBTask{Date: "20240201", Title: "Отчёт", Comment: "квартальный отчёт"})
+	}
+	addTask(t, s, models.DBTask{Date: "20240201", Title: "Прочее", Comment: "отчёт"})
+
+	var ids []string
+	var last string
+	cursor := ""
+	for {
+		page, err := s.SearchTasks(ctx, "отчёт", models.Page{Limit: 2, After: cursor})
+		require.NoError(t, err)
+		assert.Equal(t, 6, page.Total)
+		for _, task := range page.Tasks {
+			ids = append(ids, task.ID)
+			last = task.Title
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Len(t, ids, 6)
+	assert.Equal(t, "Прочее", last)
+
+	_, err := s.SearchTasks(ctx, "отчёт", models.Page{After: encodeCursor(models.DBTask{ID: "1"})})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestSearchWithoutFts(t *testing.T) {
+	s := sqliteStorage(t)
+	require.NoError(t, s.Migrate())
+	require.NoError(t, s.initSearch())
+	if s.fts {
+		t.Skip("SQLite собран с FTS5")
+	}
+	// Без FTS5 изменение задач не трогает индекс, а поиск идёт по подстроке.
+	id := addTask(t, s, models.DBTask{Date: "20240201", Title: "Молоко"})
+	require.NoError(t, s.DeleteTask(context.Background(), id))
+	addTask(t, s, models.DBTask{Date: "20240201", Title: "Молоко"})
+	page, err := s.SearchTasks(context.Background(), "олок", models.Page{})
+	require.NoError(t, err)
+	assert.Len(t, page.Tasks, 1)
+	assert.Nil(t, page.Snippets)
+}
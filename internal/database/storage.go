@@ -1,25 +1,32 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3" // Import the SQLite driver
+	_ "github.com/lib/pq" // Import the PostgreSQL driver
 	"github.com/vova4o/go_final_project/internal/config"
 	"github.com/vova4o/go_final_project/internal/models"
 	"github.com/vova4o/go_final_project/internal/nextdate"
 )
 
-// limit — количество задач, возвращаемых за один запрос из базы данных.
-const limit = 10
+// taskColumns — столбцы задачи в том порядке, в котором их читает scanTasks.
+const taskColumns = "id, date, time, title, comment, repeat, anchor, end_date, max_count, done_count, series_date"
 
 type Storage struct {
 	Db *sql.DB
+	// dialect — СУБД, с которой работает Storage; nil означает SQLite.
+	dialect *dialect
+	// fts — поиск идёт по полнотекстовому индексу SQLite, см. initSearch.
+	fts bool
 }
 
 // NewStorage создаёт новый объект Storage.
@@ -32,57 +39,163 @@ func New() (*Storage, error) {
 	return s, nil
 }
 
-// InitDB создаёт базу данных, если она не существует, и возвращает объект sql.DB для работы с ней.
-func (s *Storage) InitDB() error {
-	currentDir, err := os.Getwd()
+// Open открывает базу данных без применения миграций.
+func Open() (*Storage, error) {
+	s := &Storage{}
+	err := s.open()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return s, nil
+}
 
-	file := config.DBPath()
-
-	dbFile := filepath.Join(currentDir, file)
-	_, err = os.Stat(dbFile)
+// ErrNoDatabase возвращается OpenReadOnly, когда файла базы данных SQLite нет.
+var ErrNoDatabase = errors.New("база данных не найдена")
 
-	var install bool
+// OpenReadOnly открывает базу данных только для чтения и без применения миграций.
+// В отличие от Open, не создаёт файл SQLite, которого нет, а возвращает ErrNoDatabase.
+func OpenReadOnly() (*Storage, error) {
+	s := &Storage{}
+	err := s.openReadOnly()
 	if err != nil {
-		install = true
+		return nil, err
 	}
+	return s, nil
+}
 
-	db, err := sql.Open("sqlite3", dbFile)
+// InitDB открывает базу данных, создавая файл, если его нет, применяет к ней недостающие миграции схемы
+// и подключает полнотекстовый поиск, если он доступен.
+func (s *Storage) InitDB() error {
+	err := s.open()
 	if err != nil {
 		return err
 	}
+	err = s.Migrate()
+	if err != nil {
+		return err
+	}
+	return s.initSearch()
+}
+
+// open подключается к базе данных PostgreSQL, если config.DB() содержит её DSN, а иначе — к файлу SQLite config.DBPath().
+func (s *Storage) open() error {
+	if dsn := config.DB(); dsn != "" {
+		if !isPostgresDSN(dsn) {
+			return fmt.Errorf("база данных %q не поддерживается, ожидается DSN вида postgres:// или memory", dsn)
+		}
+		log.Println("Database: PostgreSQL")
+		return s.connect(postgresDialect, dsn)
+	}
+
+	dbFile := sqliteFile()
 
 	log.Printf("Database file: %s\n", dbFile)
 
-	if err = db.Ping(); err != nil {
-		return err
+	return s.connect(sqliteDialect, dbFile)
+}
+
+// openReadOnly подключается к базе данных так же, как open, но файл SQLite открывает только для чтения.
+func (s *Storage) openReadOnly() error {
+	if config.DB() != "" {
+		return s.open()
 	}
 
-	if install {
-		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS scheduler (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			date TEXT NOT NULL,
-			title TEXT NOT NULL,
-			comment TEXT,
-			repeat TEXT(128)
-		);`)
-		if err != nil {
-			return err
-		}
+	dbFile := sqliteFile()
+	if _, err := os.Stat(dbFile); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNoDatabase, dbFile)
+	}
 
-		_, err = db.Exec(`CREATE INDEX IF NOT EXISTS indexdate ON scheduler (date)`)
-		if err != nil {
-			log.Println("Не создан индекс", err)
-		}
+	log.Printf("Database file: %s (read-only)\n", dbFile)
+
+	return s.connect(sqliteDialect, "file:"+dbFile+"?mode=ro")
+}
+
+// sqliteFile возвращает путь к файлу SQLite config.DBPath() относительно рабочего каталога.
+func sqliteFile() string {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return filepath.Join(currentDir, config.DBPath())
+}
+
+// connect открывает базу данных dsn драйвером диалекта d и проверяет соединение с ней.
+func (s *Storage) connect(d *dialect, dsn string) error {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return err
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return err
 	}
 
 	s.Db = db
+	s.dialect = d
 
 	return nil
 }
 
+// syntax возвращает диалект СУБД, с которой работает Storage.
+func (s *Storage) syntax() *dialect {
+	if s.dialect == nil {
+		return sqliteDialect
+	}
+	return s.dialect
+}
+
+// exec, query и queryRow выполняют запрос с плейсхолдерами ?, переписанными для СУБД.
+// Запрос прерывается, когда отменяется ctx.
+func (s *Storage) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.Db.ExecContext(ctx, s.syntax().rebind(query), args...)
+}
+
+func (s *Storage) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.Db.QueryContext(ctx, s.syntax().rebind(query), args...)
+}
+
+func (s *Storage) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.Db.QueryRowContext(ctx, s.syntax().rebind(query), args...)
+}
+
+// timestamp возвращает время t в том виде, в котором оно хранится в базе данных: RFC 3339 в UTC
+// с точностью до секунды, чтобы строки сравнивались в порядке времени.
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// inTxContext выполняет f в транзакции, которая откатывается, если f вернула ошибку или отменился ctx.
+func (s *Storage) inTxContext(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// notFound возвращает ошибку «задача не найдена» вместо ошибки запроса err.
+// Ошибки отменённого контекста возвращаются как есть, чтобы обработчик отличил их от отсутствия задачи.
+func notFound(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return errors.New("задача не найдена")
+}
+
+// validID сообщает, что id — число. PostgreSQL не сравнивает числовой id со строкой, которая не является числом,
+// а возвращает ошибку, поэтому методы с таким id не обращаются к базе и отвечают, что задачи нет.
+func validID(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 64)
+	return err == nil
+}
+
 // CloseDB закрывает соединение с базой данных.
 func (s *Storage) CloseDB() {
 	if s != nil {
@@ -91,13 +204,13 @@ func (s *Storage) CloseDB() {
 }
 
 // AddTask добавляет задачу в базу данных. Возвращает идентификатор задачи.
-// исходные данные: дата, заголовок, комментарий, правило повторения.
-func (s *Storage) AddTaskDB(date string, title string, comment string, repeat string) (int64, error) {
-	result, err := s.Db.Exec("INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, ?, ?, ?)", date, title, comment, repeat)
-	if err != nil {
-		return 0, err
-	}
-	id, err := result.LastInsertId()
+// ID задачи не используется. Счётчик выполненных повторений ненулевой у задачи, дату которой перенесли из прошлого.
+func (s *Storage) AddTaskDB(ctx context.Context, task models.DBTask) (int64, error) {
+	query := `INSERT INTO scheduler (date, time, title, comment, repeat, anchor, end_date, max_count, done_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	var id int64
+	err := s.queryRow(ctx, query, task.Date, task.Time, task.Title, task.Comment, task.Repeat, task.Anchor, task.EndDate, task.MaxCount,
+		task.DoneCount).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -105,14 +218,17 @@ func (s *Storage) AddTaskDB(date string, title string, comment string, repeat st
 }
 
 // FindTask ищет задачу по идентификатору ID. Возвращает задачу или ошибку.
-func (s *Storage) FindTask(id string) (models.DBTask, error) {
+func (s *Storage) FindTask(ctx context.Context, id string) (models.DBTask, error) {
 	task := models.DBTask{}
 	if id == "" {
 		return task, errors.New("не указан id задачи")
 	}
+	if !validID(id) {
+		return task, errors.New("задача не найдена")
+	}
 
-	query := "SELECT id, date, title, comment, repeat FROM scheduler WHERE id = ?"
-	err := s.Db.QueryRow(query, id).Scan(&task.ID, &task.Date, &task.Title, &task.Comment, &task.Repeat)
+	query := "SELECT " + taskColumns + " FROM scheduler WHERE id = ?"
+	err := s.queryRow(ctx, query, id).Scan(taskFields(&task)...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.DBTask{}, errors.New("задача не найдена")
@@ -123,122 +239,220 @@ func (s *Storage) FindTask(id string) (models.DBTask, error) {
 	return task, nil
 }
 
-// UpdateTask обновляет задачу в базе данных. Возвращает ошибку.
-func (s *Storage) UpdateTask(task models.DBTask) error {
-	query := `UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ? WHERE id = ?`
-	_, err := s.Db.Exec(query, task.Date, task.Title, task.Comment, task.Repeat, task.ID)
-	if err != nil {
-		return errors.New("задача не найдена")
+// UpdateTask обновляет задачу в базе данных и записывает изменение в журнал версий (см. TaskRevisions).
+// Счётчик выполненных повторений не меняется. Как и UPDATE, изменение несуществующей задачи ничего не делает.
+func (s *Storage) UpdateTask(ctx context.Context, task models.DBTask) error {
+	err := s.inTxContext(ctx, func(tx *sql.Tx) error {
+		return s.updateTask(ctx, tx, task)
+	})
+	if errors.Is(err, ErrTaskNotFound) {
+		return nil
 	}
+	return err
+}
 
-	return nil
+// Tasks возвращает страницу списка задач, упорядоченного по дате и времени.
+// Задачи без времени идут первыми в своём дне. Возвращает страницу задач или ошибку.
+func (s *Storage) Tasks(ctx context.Context, page models.Page) (models.TaskPage, error) {
+	return s.taskPage(ctx, "", nil, page)
 }
 
-// Tasks возвращает список задач из базы данных. Возвращает список задач или ошибку.
-func (s *Storage) Tasks(offset int) ([]models.DBTask, error) {
-	query := fmt.Sprintf("SELECT id, date, title, comment, repeat FROM scheduler ORDER BY date LIMIT %d OFFSET %d", limit, offset)
-	rows, err := s.Db.Query(query)
+// taskPage возвращает страницу задач, отобранных условием where с параметрами args (пустое условие — все задачи).
+// Задачи упорядочены по дате, времени и id, поэтому страница после курсора выбирается по ключу (date, time, id),
+// без OFFSET: добавленные и удалённые задачи не сдвигают следующие страницы.
+func (s *Storage) taskPage(ctx context.Context, where string, args []any, page models.Page) (models.TaskPage, error) {
+	after, err := decodeCursor(page.After)
 	if err != nil {
-		return nil, err
+		return models.TaskPage{}, err
+	}
+	limit := pageLimit(page.Limit)
+
+	var result models.TaskPage
+	count := "SELECT count(*) FROM scheduler"
+	if where != "" {
+		count += " WHERE " + where
+	}
+	err = s.queryRow(ctx, count, args...).Scan(&result.Total)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
+	conditions := []string{}
+	if where != "" {
+		conditions = append(conditions, "("+where+")")
+	}
+	if after != nil {
+		conditions = append(conditions, "(date, time, id) > (?, ?, ?)")
+		args = append(args, after.date, after.time, after.id)
+	}
+	query := "SELECT " + taskColumns + " FROM scheduler"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Лишняя задача показывает, что за страницей есть следующая.
+	query += " ORDER BY date, time, id LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return models.TaskPage{}, err
 	}
+	result.Tasks, err = scanTasks(rows)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+	if len(result.Tasks) > limit {
+		result.Tasks = result.Tasks[:limit]
+		result.NextCursor = encodeCursor(result.Tasks[limit-1])
+	}
+	return result, nil
+}
+
+// taskFields возвращает указатели на поля задачи в порядке столбцов taskColumns.
+func taskFields(t *models.DBTask) []any {
+	return []any{&t.ID, &t.Date, &t.Time, &t.Title, &t.Comment, &t.Repeat, &t.Anchor, &t.EndDate, &t.MaxCount, &t.DoneCount, &t.SeriesDate}
+}
+
+// scanTasks читает задачи из rows, выбранные со столбцами taskColumns, и закрывает rows.
+func scanTasks(rows *sql.Rows) ([]models.DBTask, error) {
 	defer rows.Close()
 
 	var tasks []models.DBTask
 	for rows.Next() {
 		var t models.DBTask
-		err := rows.Scan(&t.ID, &t.Date, &t.Title, &t.Comment, &t.Repeat)
+		err := rows.Scan(taskFields(&t)...)
 		if err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, t)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return tasks, nil
 }
 
-func (s *Storage) SearchTasks(search string) ([]models.DBTask, error) {
-	query := "SELECT id, date, title, comment, repeat FROM scheduler WHERE title LIKE ? OR comment LIKE ?"
-	rows, err := s.Db.Query(query, "%"+search+"%", "%"+search+"%")
-	if err != nil {
-		return nil, err
+// SearchTasks возвращает страницу задач, найденных по строке search. С полнотекстовым индексом
+// задачи ищутся по словам, фразам и префиксам (см. ftsQuery), упорядочиваются по релевантности
+// и возвращаются с фрагментами текста. Без индекса ищутся задачи, в заголовке или комментарии которых
+// есть подстрока search, упорядоченные по дате и времени. Регистр букв, в том числе кириллических,
+// и различие «е» и «ё» не учитываются.
+func (s *Storage) SearchTasks(ctx context.Context, search string, page models.Page) (models.TaskPage, error) {
+	if match := ftsQuery(foldText(search)); s.fts && match != "" {
+		return s.searchRanked(ctx, match, page)
 	}
-	defer rows.Close()
+	d := s.syntax()
+	pattern := "%" + foldText(search) + "%"
+	return s.taskPage(ctx, d.foldColumn("title")+" LIKE ? OR "+d.foldColumn("comment")+" LIKE ?", []any{pattern, pattern}, page)
+}
 
-	var tasks []models.DBTask
-	for rows.Next() {
-		var t models.DBTask
-		err := rows.Scan(&t.ID, &t.Date, &t.Title, &t.Comment, &t.Repeat)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, t)
-	}
-	return tasks, nil
+// TasksByDate возвращает страницу задач на дату date, упорядоченных по времени.
+func (s *Storage) TasksByDate(ctx context.Context, date string, page models.Page) (models.TaskPage, error) {
+	return s.taskPage(ctx, "date = ?", []any{date}, page)
 }
 
-func (s *Storage) TasksByDate(date string) ([]models.DBTask, error) {
-	query := "SELECT id, date, title, comment, repeat FROM scheduler WHERE date = ?"
-	rows, err := s.Db.Query(query, date)
+// TasksUntil возвращает все задачи с датой не позже date — только у них могут быть повторения до date включительно.
+func (s *Storage) TasksUntil(ctx context.Context, date string) ([]models.DBTask, error) {
+	query := "SELECT " + taskColumns + " FROM scheduler WHERE date <= ? ORDER BY date, time"
+	rows, err := s.query(ctx, query, date)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var tasks []models.DBTask
-	for rows.Next() {
-		var t models.DBTask
-		err := rows.Scan(&t.ID, &t.Date, &t.Title, &t.Comment, &t.Repeat)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, t)
-	}
-	return tasks, nil
+	return scanTasks(rows)
 }
 
-// DoneTask помечает задачу как выполненную. Возвращает ошибку. Если задача повторяющаяся, то создаёт новую задачу на следующую дату.
-func (s *Storage) DoneTask(id string) error {
-	var taskWeDeleting models.DBTask
-	err := s.Db.QueryRow("SELECT id, date, title, comment, repeat FROM scheduler WHERE id = ?", id).Scan(&taskWeDeleting.ID, &taskWeDeleting.Date, &taskWeDeleting.Title, &taskWeDeleting.Comment, &taskWeDeleting.Repeat)
-	if err != nil {
+// DoneTask помечает задачу как выполненную. Возвращает ошибку. Если задача повторяющаяся, то переносит её
+// на следующую дату по правилам completeTask, а когда серия заканчивается, удаляет.
+// Каждое выполнение записывается в историю вместе с комментарием note, см. TaskHistory.
+// now — текущее время в часовом поясе пользователя.
+func (s *Storage) DoneTask(ctx context.Context, id string, now time.Time, note string) error {
+	if !validID(id) {
 		return errors.New("задача не найдена")
 	}
-
-	if taskWeDeleting.Repeat == "" {
-		_, err := s.Db.Exec("DELETE FROM scheduler WHERE id = ?", id)
+	return s.inTxContext(ctx, func(tx *sql.Tx) error {
+		d := s.syntax()
+		var taskWeDeleting models.DBTask
+		err := tx.QueryRowContext(ctx, d.rebind("SELECT "+taskColumns+" FROM scheduler WHERE id = ?"), id).Scan(taskFields(&taskWeDeleting)...)
 		if err != nil {
-			return errors.New("задача не найдена")
+			return notFound(err)
 		}
-	} else {
-		taskWeDeleting.Date, err = nextdate.NextDate(time.Now(), taskWeDeleting.Date, taskWeDeleting.Repeat)
+
+		done := newCompletion(taskWeDeleting, now, note)
+		_, err = tx.ExecContext(ctx, d.rebind("INSERT INTO completions (task_id, title, date, time, done_at, done_date, note) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+			taskWeDeleting.ID, done.Title, done.Date, done.Time, done.DoneAt, now.Format("20060102"), done.Note)
 		if err != nil {
 			return err
 		}
-		err = s.UpdateTask(taskWeDeleting)
+
+		keep, err := completeTask(&taskWeDeleting, now)
 		if err != nil {
 			return err
 		}
-	}
+		if !keep {
+			_, err := tx.ExecContext(ctx, d.rebind("DELETE FROM scheduler WHERE id = ?"), id)
+			if err != nil {
+				return notFound(err)
+			}
+			return nil
+		}
 
-	return nil
+		query := `UPDATE scheduler SET date = ?, time = ?, repeat = ?, done_count = ?, series_date = ? WHERE id = ?`
+		_, err = tx.ExecContext(ctx, d.rebind(query), taskWeDeleting.Date, taskWeDeleting.Time, taskWeDeleting.Repeat, taskWeDeleting.DoneCount,
+			taskWeDeleting.SeriesDate, id)
+		return err
+	})
 }
 
-// DeleteTask удаляет задачу из базы данных. Возвращает ошибку.
-func (s *Storage) DeleteTask(id string) error {
-	var exists bool
-	err := s.Db.QueryRow("SELECT exists(SELECT 1 FROM scheduler WHERE id=?)", id).Scan(&exists)
-	if err != nil || !exists {
-		return fmt.Errorf("задача не найдена")
+// completeTask переносит задачу, выполненную в момент now, на следующее повторение. Возвращает false,
+// если задача выполнена окончательно и её нужно удалить: у неё нет правила повторения или серия закончилась.
+// Время задачи переносится на следующую дату без изменений, а задача с правилом h или min переносится
+// на первый слот после now. У задачи с режимом completion повторения отсчитываются от дня выполнения,
+// а у задачи, перенесённой на рабочий день, — от даты серии до переноса.
+// Серия заканчивается по дате окончания или числу повторений задачи либо по COUNT или UNTIL в правиле.
+func completeTask(task *models.DBTask, now time.Time) (bool, error) {
+	if task.Repeat == "" {
+		return false, nil
+	}
+
+	limit := nextdate.Limit{EndDate: task.EndDate, MaxCount: task.MaxCount}
+	if limit.MaxCount > 0 && task.DoneCount+1 >= limit.MaxCount {
+		// Выполнено последнее повторение серии.
+		return false, nil
 	}
 
-	_, err = s.Db.Exec("DELETE FROM scheduler WHERE id = ?", id)
+	date, series, clock, repeat, err := nextdate.Complete(now, task.Date, task.SeriesDate, task.Time, task.Repeat, nextdate.Anchor(task.Anchor))
+	if errors.Is(err, nextdate.ErrNoOccurrence) || (err == nil && limit.Ended(date)) {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	task.Date, task.SeriesDate, task.Time, task.Repeat = date, series, clock, repeat
+	if limit.MaxCount > 0 {
+		task.DoneCount++
+	}
+	return true, nil
+}
+
+// DeleteTask переносит задачу в корзину, откуда её можно восстановить RestoreTask. Возвращает ошибку, если задачи нет.
+func (s *Storage) DeleteTask(ctx context.Context, id string) error {
+	if !validID(id) {
+		return errors.New("задача не найдена")
+	}
+	return s.inTxContext(ctx, func(tx *sql.Tx) error {
+		d := s.syntax()
+		res, err := tx.ExecContext(ctx, d.rebind("INSERT INTO trash ("+taskColumns+", deleted_at) SELECT "+taskColumns+", ? FROM scheduler WHERE id = ?"),
+			timestamp(time.Now()), id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return notFound(err)
+		}
+		_, err = tx.ExecContext(ctx, d.rebind("DELETE FROM scheduler WHERE id = ?"), id)
+		return err
+	})
 }
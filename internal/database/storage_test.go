@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -10,6 +11,9 @@ import (
 	"github.com/vova4o/go_final_project/internal/nextdate"
 )
 
+// taskColumnNames — столбцы, которые Storage читает из таблицы scheduler.
+var taskColumnNames = []string{"id", "date", "time", "title", "comment", "repeat", "anchor", "end_date", "max_count", "done_count", "series_date"}
+
 func TestTasks(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -19,20 +23,25 @@ func TestTasks(t *testing.T) {
 
 	s := &Storage{Db: db}
 
-	rows := sqlmock.NewRows([]string{"id", "date", "title", "comment", "repeat"}).
-		AddRow("1", "20240131", "Заголовок задачи", "", "").
-		AddRow("2", "20240131", "Фитнес", "", "d 3")
+	rows := sqlmock.NewRows(taskColumnNames).
+		AddRow("1", "20240131", "", "Заголовок задачи", "", "", "schedule", "", 0, 0, "").
+		AddRow("2", "20240131", "18:30", "Фитнес", "", "d 3", "completion", "", 0, 0, "")
 
-	mock.ExpectQuery("^SELECT id, date, title, comment, repeat FROM scheduler ORDER BY date LIMIT 10 OFFSET (.+)$").WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT count\\(\\*\\) FROM scheduler$").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("^SELECT id, date, time, title, comment, repeat, anchor, end_date, max_count, done_count, series_date FROM scheduler ORDER BY date, time, id LIMIT \\?$").
+		WithArgs(DefaultLimit + 1).WillReturnRows(rows)
 
-	tasks, err := s.Tasks(0)
+	page, err := s.Tasks(context.Background(), models.Page{})
 	if err != nil {
 		t.Errorf("error was not expected while getting tasks: %s", err)
 	}
+	tasks := page.Tasks
+	assert.Equal(t, 2, page.Total)
+	assert.Empty(t, page.NextCursor)
 
 	want := []models.DBTask{
-		{ID: "1", Date: "20240131", Title: "Заголовок задачи", Comment: "", Repeat: ""},
-		{ID: "2", Date: "20240131", Title: "Фитнес", Comment: "", Repeat: "d 3"},
+		{ID: "1", Date: "20240131", Title: "Заголовок задачи", Comment: "", Repeat: "", Anchor: "schedule"},
+		{ID: "2", Date: "20240131", Time: "18:30", Title: "Фитнес", Comment: "", Repeat: "d 3", Anchor: "completion"},
 	}
 
 	assert.Equal(t, want, tasks, "The two arrays should be the same.")
@@ -94,6 +103,20 @@ func TestAddWeeks(t *testing.T) {
 			want:    "20240202",
 			wantErr: false,
 		},
+		{
+			name:    "add w 7,3 sunday before wednesday",
+			t:       time.Date(2024, 1, 24, 0, 0, 0, 0, time.UTC),
+			repeat:  "w 7,3",
+			want:    "20240128",
+			wantErr: false,
+		},
+		{
+			name:    "add w 5,6 first matching day",
+			t:       time.Date(2024, 1, 27, 0, 0, 0, 0, time.UTC),
+			repeat:  "w 5,6",
+			want:    "20240202",
+			wantErr: false,
+		},
 		// add more test cases here
 	}
 
@@ -210,6 +233,27 @@ func TestAddMonth(t *testing.T) {
 			want:    "20240507",
 			wantErr: false,
 		},
+		{
+			name:    "add m 31 after the 31st",
+			t:       time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+			repeat:  "m 31",
+			want:    "20240331",
+			wantErr: false,
+		},
+		{
+			name:    "add m 1,15 not before date",
+			t:       time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC),
+			repeat:  "m 1,15",
+			want:    "20240215",
+			wantErr: false,
+		},
+		{
+			name:    "add m 31 4,5 skips short month",
+			t:       time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC),
+			repeat:  "m 31 4,5",
+			want:    "20240531",
+			wantErr: false,
+		},
 		{
 			name:    "add m 40,11,19",
 			t:       time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC),
@@ -244,15 +288,17 @@ func TestSearchTasksByDate(t *testing.T) {
 
 	s := &Storage{Db: db}
 	// Mock the query
-	rows := sqlmock.NewRows([]string{"id", "date", "title", "comment", "repeat"}).
-		AddRow("1", "20220101", "Test Title", "Test Comment", "Test Repeat")
-	mock.ExpectQuery("^SELECT (.+) FROM scheduler WHERE date = ?").WithArgs("20220101").WillReturnRows(rows)
+	rows := sqlmock.NewRows(taskColumnNames).
+		AddRow("1", "20220101", "", "Test Title", "Test Comment", "Test Repeat", "schedule", "", 0, 0, "")
+	mock.ExpectQuery("^SELECT count\\(\\*\\) FROM scheduler WHERE date = ?").WithArgs("20220101").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("^SELECT (.+) FROM scheduler WHERE \\(date = \\?\\) ORDER BY date, time, id LIMIT \\?$").WithArgs("20220101", DefaultLimit+1).WillReturnRows(rows)
 
 	// Test SearchTasksByDate function
-	tasks, err := s.TasksByDate("20220101")
+	page, err := s.TasksByDate(context.Background(), "20220101", models.Page{})
 	if err != nil {
 		t.Fatalf("Failed to search tasks by date: %v", err)
 	}
+	tasks := page.Tasks
 
 	// Check if the returned tasks are correct
 	if len(tasks) != 1 {
@@ -262,3 +308,181 @@ func TestSearchTasksByDate(t *testing.T) {
 		t.Errorf("Returned task does not match expected task")
 	}
 }
+
+func TestDoneTaskKeepsTime(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	s := &Storage{Db: db}
+	rows := sqlmock.NewRows(taskColumnNames).
+		AddRow("1", "20220101", "09:15", "Планёрка", "", "d 1", "schedule", "", 0, 0, "")
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT (.+) FROM scheduler WHERE id = ?").WithArgs("1").WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO completions").WillReturnResult(sqlmock.NewResult(1, 1))
+	now := time.Now()
+	next := now.AddDate(0, 0, 1).Format("20060102")
+	mock.ExpectExec("^UPDATE scheduler SET date = \\?, time = \\?, repeat = \\?, done_count = \\?, series_date = \\?").
+		WithArgs(next, "09:15", "d 1", 0, "", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := s.DoneTask(context.Background(), "1", now, ""); err != nil {
+		t.Fatalf("DoneTask returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDoneTaskSubDaily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	s := &Storage{Db: db}
+	rows := sqlmock.NewRows(taskColumnNames).
+		AddRow("1", "20240126", "08:00", "Проверить логи", "", "h 4", "schedule", "", 0, 0, "")
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT (.+) FROM scheduler WHERE id = ?").WithArgs("1").WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO completions").
+		WithArgs("1", "Проверить логи", "20240126", "08:00", "2024-01-26T10:07:00Z", "20240126", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^UPDATE scheduler SET date = \\?, time = \\?, repeat = \\?, done_count = \\?, series_date = \\?").
+		WithArgs("20240126", "12:00", "h 4", 0, "", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	now := time.Date(2024, 1, 26, 10, 7, 0, 0, time.UTC)
+	if err := s.DoneTask(context.Background(), "1", now, ""); err != nil {
+		t.Fatalf("DoneTask returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDoneTaskFromCompletion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	s := &Storage{Db: db}
+	rows := sqlmock.NewRows(taskColumnNames).
+		AddRow("1", "20240120", "", "Полить цветы", "", "d 7", "completion", "", 0, 0, "")
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT (.+) FROM scheduler WHERE id = ?").WithArgs("1").WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO completions").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^UPDATE scheduler SET date = \\?, time = \\?, repeat = \\?, done_count = \\?, series_date = \\?").
+		WithArgs("20240202", "", "d 7", 0, "", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	now := time.Date(2024, 1, 26, 10, 7, 0, 0, time.UTC)
+	if err := s.DoneTask(context.Background(), "1", now, ""); err != nil {
+		t.Fatalf("DoneTask returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDoneTaskEnd(t *testing.T) {
+	now := time.Date(2024, 1, 26, 10, 7, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		endDate   string
+		maxCount  int
+		doneCount int
+		wantNext  string // пустая — задача удаляется
+		wantDone  int
+	}{
+		{"no limits", "", 0, 0, "20240127", 0},
+		{"before end date", "20240127", 0, 0, "20240127", 0},
+		{"after end date", "20240126", 0, 0, "", 0},
+		{"count left", "", 3, 1, "20240127", 2},
+		{"last occurrence", "", 3, 2, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			s := &Storage{Db: db}
+			rows := sqlmock.NewRows(taskColumnNames).
+				AddRow("1", "20240126", "", "Принять лекарство", "", "d 1", "schedule", tt.endDate, tt.maxCount, tt.doneCount, "")
+			mock.ExpectBegin()
+			mock.ExpectQuery("^SELECT (.+) FROM scheduler WHERE id = ?").WithArgs("1").WillReturnRows(rows)
+			mock.ExpectExec("^INSERT INTO completions").WillReturnResult(sqlmock.NewResult(1, 1))
+			if tt.wantNext == "" {
+				mock.ExpectExec("^DELETE FROM scheduler WHERE id = ?").WithArgs("1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			} else {
+				mock.ExpectExec("^UPDATE scheduler SET date = \\?, time = \\?, repeat = \\?, done_count = \\?, series_date = \\?").
+					WithArgs(tt.wantNext, "", "d 1", tt.wantDone, "", "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			if err := s.DoneTask(context.Background(), "1", now, ""); err != nil {
+				t.Fatalf("DoneTask returned error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTasksUntil(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	s := &Storage{Db: db}
+	rows := sqlmock.NewRows(taskColumnNames).
+		AddRow("1", "20240120", "", "Полив", "", "d 3", "schedule", "", 0, 0, "")
+	mock.ExpectQuery("^SELECT (.+) FROM scheduler WHERE date <= \\? ORDER BY date, time$").WithArgs("20240204").WillReturnRows(rows)
+
+	tasks, err := s.TasksUntil(context.Background(), "20240204")
+	if err != nil {
+		t.Fatalf("TasksUntil returned error: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Repeat != "d 3" {
+		t.Errorf("TasksUntil() = %v", tasks)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	s := sqliteStorage(t)
+
+	// База, созданная до появления миграций: только исходные столбцы и столбец time, добавленный при запуске.
+	_, err := s.Db.Exec(`CREATE TABLE scheduler (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date TEXT NOT NULL,
+		title TEXT NOT NULL,
+		comment TEXT,
+		repeat TEXT(128),
+		time TEXT NOT NULL DEFAULT ''
+	)`)
+	assert.NoError(t, err)
+	_, err = s.Db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES ('20240131', 'Старая задача', '', 'd 1')`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Migrate())
+
+	task, err := s.FindTask(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DBTask{ID: "1", Date: "20240131", Title: "Старая задача", Repeat: "d 1", Anchor: "schedule"}, task)
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+// ErrNotInTrash — задачи с таким id нет в корзине.
+var ErrNotInTrash = errors.New("задача не найдена в корзине")
+
+// TrashTasks возвращает задачи из корзины, начиная с удалённых последними.
+func (s *Storage) TrashTasks(ctx context.Context) ([]models.TrashTask, error) {
+	rows, err := s.query(ctx, "SELECT "+taskColumns+", deleted_at FROM trash ORDER BY deleted_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.TrashTask
+	for rows.Next() {
+		var t models.TrashTask
+		if err := rows.Scan(append(taskFields(&t.DBTask), &t.DeletedAt)...); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// RestoreTask возвращает задачу из корзины в список задач с прежним id.
+// Если задачи нет в корзине, возвращает ErrNotInTrash.
+func (s *Storage) RestoreTask(ctx context.Context, id string) error {
+	if !validID(id) {
+		return ErrNotInTrash
+	}
+	return s.inTxContext(ctx, func(tx *sql.Tx) error {
+		d := s.syntax()
+		res, err := tx.ExecContext(ctx, d.rebind("INSERT INTO scheduler ("+taskColumns+") SELECT "+taskColumns+" FROM trash WHERE id = ?"), id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return notInTrash(err)
+		}
+		_, err = tx.ExecContext(ctx, d.rebind("DELETE FROM trash WHERE id = ?"), id)
+		return err
+	})
+}
+
+// RemoveFromTrash удаляет задачу из корзины навсегда. Если задачи нет в корзине, возвращает ErrNotInTrash.
+func (s *Storage) RemoveFromTrash(ctx context.Context, id string) error {
+	if !validID(id) {
+		return ErrNotInTrash
+	}
+	res, err := s.exec(ctx, "DELETE FROM trash WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return notInTrash(err)
+	}
+	return nil
+}
+
+// EmptyTrash удаляет навсегда все задачи из корзины. Возвращает число удалённых задач.
+func (s *Storage) EmptyTrash(ctx context.Context) (int64, error) {
+	res, err := s.exec(ctx, "DELETE FROM trash")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PurgeTrash удаляет навсегда задачи, попавшие в корзину раньше before. Возвращает число удалённых задач.
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.exec(ctx, "DELETE FROM trash WHERE deleted_at < ?", timestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func notInTrash(err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrNotInTrash
+}
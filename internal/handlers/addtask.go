@@ -14,10 +14,16 @@ import (
 )
 
 type task struct {
-	Date    string `json:"date,omitempty"`
-	Title   string `json:"title"`
-	Comment string `json:"comment,omitempty"`
-	Repeat  string `json:"repeat,omitempty"`
+	Date     string `json:"date,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Title    string `json:"title"`
+	Comment  string `json:"comment,omitempty"`
+	Repeat   string `json:"repeat,omitempty"`
+	Anchor   string `json:"anchor,omitempty"`
+	EndDate  string `json:"end_date,omitempty"`
+	MaxCount int    `json:"max_count,omitempty"`
+	// DoneCount — сколько повторений серии уже прошло; клиент его не передаёт, его считает checkTask.
+	DoneCount int `json:"-"`
 }
 
 type Handler struct {
@@ -39,116 +45,242 @@ func (h *Handler) AddTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	err = t.checkTask()
+	now, err := requestNow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = t.checkTask(now)
 	if err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	id, err := h.Storage.AddTaskDB(t.Date, t.Title, t.Comment, t.Repeat)
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id, err := h.Storage.AddTaskDB(ctx, models.DBTask{
+		Date:      t.Date,
+		Time:      t.Time,
+		Title:     t.Title,
+		Comment:   t.Comment,
+		Repeat:    t.Repeat,
+		Anchor:    t.Anchor,
+		EndDate:   t.EndDate,
+		MaxCount:  t.MaxCount,
+		DoneCount: t.DoneCount,
+	})
 	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		storageError(c, ctx, err, http.StatusInternalServerError)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"id": id})
 }
 
+// taskUpdate — тело запроса PUT /api/task. Поля, которых нет в форме веб-интерфейса, — указатели:
+// если поле не передано, у задачи остаётся значение из базы, а не пустое.
+type taskUpdate struct {
+	ID       string  `json:"id"`
+	Date     string  `json:"date"`
+	Time     *string `json:"time"`
+	Title    string  `json:"title"`
+	Comment  string  `json:"comment"`
+	Repeat   string  `json:"repeat"`
+	Anchor   *string `json:"anchor"`
+	EndDate  *string `json:"end_date"`
+	MaxCount *int    `json:"max_count"`
+}
+
 // UpdateTask обновляет задачу по id в базе данных.
+// Время, режим повторения и условия окончания серии, которых нет в запросе, не меняются.
 func (h *Handler) UpdateTask(c *gin.Context) {
-	var t models.DBTask
-	if err := c.ShouldBindJSON(&t); err != nil {
+	var u taskUpdate
+	if err := c.ShouldBindJSON(&u); err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	checkT := task{
-		Date:    t.Date,
-		Title:   t.Title,
-		Comment: t.Comment,
-		Repeat:  t.Repeat,
+	if u.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не указан id задачи"})
+		return
 	}
 
-	err := checkT.checkTask()
+	_, err := strconv.Atoi(u.ID)
 	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id задачи должен быть числом"})
 		return
 	}
 
-	if t.ID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "не указан id задачи"})
+	now, err := requestNow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err = strconv.Atoi(t.ID)
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	t, err := h.Storage.FindTask(ctx, u.ID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "id задачи должен быть числом"})
+		storageError(c, ctx, err, http.StatusNotFound)
 		return
 	}
 
-	_, err = h.Storage.FindTask(t.ID)
+	t.Date, t.Title, t.Comment, t.Repeat = u.Date, u.Title, u.Comment, u.Repeat
+	if u.Time != nil {
+		t.Time = *u.Time
+	}
+	if u.Anchor != nil {
+		t.Anchor = *u.Anchor
+	}
+	if u.EndDate != nil {
+		t.EndDate = *u.EndDate
+	}
+	if u.MaxCount != nil {
+		t.MaxCount = *u.MaxCount
+	}
+
+	checkT := task{
+		Date:      t.Date,
+		Time:      t.Time,
+		Title:     t.Title,
+		Comment:   t.Comment,
+		Repeat:    t.Repeat,
+		Anchor:    t.Anchor,
+		EndDate:   t.EndDate,
+		MaxCount:  t.MaxCount,
+		DoneCount: t.DoneCount,
+	}
+
+	err = checkT.checkTask(now)
 	if err != nil {
 		log.Error(err)
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// В базу попадают исправленные значения: дата в формате 20060102, режим повторения по умолчанию
+	// и дата, перенесённая на следующее повторение, вместе с пропущенными при этом повторениями.
+	t.Date, t.Time, t.Repeat, t.Anchor = checkT.Date, checkT.Time, checkT.Repeat, checkT.Anchor
+	t.DoneCount = checkT.DoneCount
 
-	err = h.Storage.UpdateTask(t)
+	err = h.Storage.UpdateTask(ctx, t)
 	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		storageError(c, ctx, err, http.StatusInternalServerError)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{})
 }
 
-// checkTask проверяет корректность данных задачи и возвращает исправленную задачу и ошибку
-func (t *task) checkTask() error {
+// checkTask проверяет корректность данных задачи и возвращает исправленную задачу и ошибку.
+// now — текущее время в часовом поясе пользователя, по нему определяется сегодняшняя дата.
+func (t *task) checkTask(now time.Time) error {
 	if t.Title == "" {
 		return fmt.Errorf("не указан заголовок задачи")
 	}
 	if t.Date == "" {
-		t.Date = time.Now().Format("20060102")
+		t.Date = now.Format("20060102")
 	}
-	date, err := time.Parse("20060102", t.Date)
+	// Дату можно указать и выражением вроде "завтра" или "+3d", в базу она попадает в формате 20060102.
+	date, err := nextdate.ParseTaskDate(t.Date, now)
 	if err != nil {
-		return fmt.Errorf("дата представлена в формате, отличном от 20060102")
+		return err
 	}
+	t.Date = date.Format("20060102")
 
-	if t.Repeat != "" && t.Repeat[0] != 'd' && t.Repeat[0] != 'w' && t.Repeat[0] != 'm' && t.Repeat[0] != 'y' {
-		return errors.New("неверное правило повторения")
+	clock, err := nextdate.ParseClock(t.Time)
+	if err != nil {
+		return err
 	}
 
-	if len(t.Repeat) > 0 {
-		if t.Repeat[0] != 'd' && t.Repeat[0] != 'w' && t.Repeat[0] != 'm' && t.Repeat[0] != 'y' {
-			return errors.New("неверное правило повторения")
-		}
-		if t.Repeat[0] == 'd' || t.Repeat[0] == 'w' || t.Repeat[0] == 'm' {
-			if len(t.Repeat) < 3 {
-				return errors.New("неверное правило повторения")
-			}
+	anchor, err := nextdate.ParseAnchor(t.Anchor)
+	if err != nil {
+		return err
+	}
+	t.Anchor = string(anchor)
+
+	limit := nextdate.Limit{EndDate: t.EndDate, MaxCount: t.MaxCount}
+	if err := limit.Check(); err != nil {
+		return err
+	}
+
+	var rule nextdate.Rule
+	if t.Repeat != "" {
+		// Правило проверяется целиком, чтобы в базу не попало правило, по которому нельзя вычислить дату.
+		if rule, err = nextdate.ParseRule(t.Repeat); err != nil {
+			return err
 		}
 	}
+	_, subDaily := rule.(nextdate.SubDailyRule)
 
-	if date.Truncate(24 * time.Hour).Before(time.Now().Truncate(24 * time.Hour)) {
+	// Даты задач хранятся без часового пояса, поэтому сравниваются с показаниями часов пользователя.
+	today := wallClock(now).Truncate(24 * time.Hour)
+
+	if date.Before(today) {
 		if t.Repeat == "" {
-			t.Date = time.Now().Format("20060102")
+			t.Date = now.Format("20060102")
+		}
+	}
+
+	// У повторяющейся задачи со временем сегодняшнее повторение тоже могло уже пройти.
+	// Правила h и min всегда отсчитываются от времени задачи, даже пустого.
+	if (t.Time != "" || subDaily) && t.Repeat != "" && date.Add(clock).Before(wallClock(now)) {
+		past := *t
+		t.Date, t.Time, t.Repeat, err = nextdate.AdvanceAt(now, t.Date, t.Time, t.Repeat)
+		if err != nil {
+			return fmt.Errorf("ошибка при вычислении следующей даты: %v", err)
+		}
+		if err := t.countPassed(past); err != nil {
+			return err
 		}
+		return t.checkEnd(limit)
 	}
 
-	if date.Truncate(24 * time.Hour).Before(time.Now().Truncate(24 * time.Hour)) {
+	if date.Before(today) {
 		if t.Repeat != "" {
-			t.Date, err = nextdate.NextDate(time.Now(), t.Date, t.Repeat)
+			past := *t
+			t.Date, t.Repeat, err = nextdate.Advance(now, t.Date, t.Repeat)
 			if err != nil {
 				return fmt.Errorf("ошибка при вычислении следующей даты: %v", err)
 			}
+			if err := t.countPassed(past); err != nil {
+				return err
+			}
 		}
 	}
 
+	return t.checkEnd(limit)
+}
+
+// countPassed засчитывает в DoneCount повторения, которые пропущены при переносе задачи past на её текущую дату.
+// Если при этом повторения, разрешённые max_count, закончились, задача отклоняется.
+func (t *task) countPassed(past task) error {
+	if t.MaxCount == 0 {
+		return nil
+	}
+	passed, err := nextdate.Passed(past.Date, past.Time, t.Date, t.Time, past.Repeat, t.MaxCount-t.DoneCount)
+	if err != nil {
+		return fmt.Errorf("ошибка при вычислении следующей даты: %v", err)
+	}
+	t.DoneCount += passed
+	if t.DoneCount >= t.MaxCount {
+		return &nextdate.RuleError{Rule: past.Repeat, Reason: fmt.Sprintf("к сегодняшнему дню прошли все повторения серии (max_count = %d)", t.MaxCount)}
+	}
 	return nil
 }
+
+// checkEnd проверяет, что дата задачи не позже даты окончания её повторений.
+func (t *task) checkEnd(limit nextdate.Limit) error {
+	if t.Repeat != "" && limit.Ended(t.Date) {
+		return fmt.Errorf("дата окончания повторений раньше даты задачи")
+	}
+	return nil
+}
+
+// wallClock возвращает показания часов момента t как время в UTC, чтобы сравнивать его с датой и временем задачи.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
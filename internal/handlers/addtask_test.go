@@ -1,9 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vova4o/go_final_project/internal/database"
+	"github.com/vova4o/go_final_project/internal/models"
+	"github.com/vova4o/go_final_project/internal/nextdate"
 )
 
 func TestCheckTask(t *testing.T) {
@@ -30,7 +41,7 @@ func TestCheckTask(t *testing.T) {
 				Comment: "This is a test task",
 				Repeat:  "d",
 			},
-			want: errors.New("неверное правило повторения"),
+			want: errors.New(`неверное правило повторения "d": не указан интервал в днях`),
 		},
 		{
 			name: "Wrong repeat rule",
@@ -40,7 +51,7 @@ func TestCheckTask(t *testing.T) {
 				Comment: "",
 				Repeat:  "l",
 			},
-			want: errors.New("неверное правило повторения"),
+			want: errors.New(`неверное правило повторения "l": "l" — неизвестный тип правила, ожидается d, w, m, mw, mb, y, h, min или RRULE:`),
 		},
 		{
 			name: "No title",
@@ -65,12 +76,92 @@ func TestCheckTask(t *testing.T) {
 		{
 			name: "wrong date format",
 			task: task{
-				Date:    "2024-10-01",
+				Date:    "2024/10/01",
 				Title:   "Test Task",
 				Comment: "",
 				Repeat:  "y",
 			},
-			want: errors.New("дата представлена в формате, отличном от 20060102"),
+			want: nextdate.ErrTaskDateFormat,
+		},
+		{
+			name: "Unparsable month",
+			task: task{
+				Date:    "20241001",
+				Title:   "Test Task",
+				Comment: "",
+				Repeat:  "m 1,x 13",
+			},
+			want: errors.New(`неверное правило повторения "m 1,x 13": "x" — день месяца должен быть числом от 1 до 31, -1 или -2`),
+		},
+		{
+			name: "Wrong time format",
+			task: task{
+				Date:    "20241001",
+				Time:    "25:00",
+				Title:   "Test Task",
+				Comment: "",
+				Repeat:  "",
+			},
+			want: errors.New("время представлено в формате, отличном от 15:04"),
+		},
+		{
+			name: "Unknown anchor",
+			task: task{
+				Date:   "20241001",
+				Title:  "Test Task",
+				Repeat: "d 7",
+				Anchor: "done",
+			},
+			want: errors.New(`режим повторения "done" не поддерживается, доступны schedule и completion`),
+		},
+		{
+			name: "End date before date",
+			task: task{
+				Date:    "20241001",
+				Title:   "Test Task",
+				Repeat:  "d 7",
+				EndDate: "20240901",
+			},
+			want: errors.New("дата окончания повторений раньше даты задачи"),
+		},
+		{
+			name: "Wrong end date format",
+			task: task{
+				Date:    "20241001",
+				Title:   "Test Task",
+				Repeat:  "d 7",
+				EndDate: "01.09.2025",
+			},
+			want: errors.New("дата окончания представлена в формате, отличном от 20060102"),
+		},
+		{
+			name: "Negative max count",
+			task: task{
+				Date:     "20241001",
+				Title:    "Test Task",
+				Repeat:   "d 7",
+				MaxCount: -2,
+			},
+			want: errors.New("число повторений должно быть от 1 до 10000, 0 — без ограничения"),
+		},
+		{
+			name: "Valid time",
+			task: task{
+				Date:    "20241001",
+				Time:    "09:30",
+				Title:   "Test Task",
+				Comment: "",
+				Repeat:  "d 1",
+			},
+			want: nil,
+		},
+		{
+			name: "Search date format",
+			task: task{
+				Date:  "28.01.2024",
+				Title: "Test Task",
+			},
+			want: nextdate.ErrTaskDateFormat,
 		},
 
 		// Add more test cases here
@@ -78,7 +169,7 @@ func TestCheckTask(t *testing.T) {
 
 	for _, tt := range tests {
         t.Run(tt.name, func(t *testing.T) {
-            err := tt.task.checkTask()
+            err := tt.task.checkTask(time.Now())
             if err != nil && tt.want != nil {
                 if err.Error() != tt.want.Error() {
                     t.Errorf("checkTask() error = %v, wantErr %v", err, tt.want)
@@ -102,18 +193,18 @@ func TestCheckTask2(t *testing.T) {
 		{
 			name: "wrong date format",
 			task: task{
-				Date:    "2024-10-01",
+				Date:    "2024/10/01",
 				Title:   "Test Task",
 				Comment: "",
 				Repeat:  "y",
 			},
 			wantTask: &task{
-				Date:    "2024-10-01", // Expected date
+				Date:    "2024/10/01", // Expected date
 				Title:   "Test Task",
 				Comment: "",
 				Repeat:  "y",
 			},
-			wantErr: errors.New("дата представлена в формате, отличном от 20060102"),
+			wantErr: nextdate.ErrTaskDateFormat,
 		},
 		{
 			name: "test case 2",
@@ -146,7 +237,7 @@ func TestCheckTask2(t *testing.T) {
 				Comment: "",
 				Repeat:  "",
 			},
-			wantErr: errors.New("дата представлена в формате, отличном от 20060102"),
+			wantErr: nextdate.ErrTaskDateFormat,
 			// Add your expected task and error here
 		},
 		{
@@ -163,7 +254,7 @@ func TestCheckTask2(t *testing.T) {
 				Comment: "",
 				Repeat:  "",
 			},
-			wantErr: errors.New("дата представлена в формате, отличном от 20060102"),
+			wantErr: nextdate.ErrTaskDateFormat,
 
 			// Add your expected task and error here
 		},
@@ -181,7 +272,7 @@ func TestCheckTask2(t *testing.T) {
 				Comment: "",
 				Repeat:  "w",
 			},
-			wantErr: errors.New("неверное правило повторения"),
+			wantErr: errors.New(`неверное правило повторения "w": не указаны дни недели`),
 			// Add your expected task and error here
 		},
 		{
@@ -198,24 +289,24 @@ func TestCheckTask2(t *testing.T) {
 				Comment: "",
 				Repeat:  "ooops",
 			},
-			wantErr: errors.New("неверное правило повторения"),
+			wantErr: errors.New(`неверное правило повторения "ooops": "ooops" — неизвестный тип правила, ожидается d, w, m, mw, mb, y, h, min или RRULE:`),
 			// Add your expected task and error here
 		},
 		{
 			name: "test case 7",
 			task: task{
-				Date:    "today",
+				Date:    "someday",
 				Title:   "Заголовок",
 				Comment: "",
 				Repeat:  "",
 			},
 			wantTask: &task{
-				Date:    "today", // Expected date
+				Date:    "someday", // Expected date
 				Title:   "Заголовок",
 				Comment: "",
 				Repeat:  "",
 			},
-			wantErr: errors.New("дата представлена в формате, отличном от 20060102"),
+			wantErr: nextdate.ErrTaskDateFormat,
 			// Add your expected task and error here
 		},
 		{
@@ -252,12 +343,24 @@ func TestCheckTask2(t *testing.T) {
 			wantErr: nil,
 			// Add your expected task and error here
 		},
+		{
+			name: "slash date",
+			task: task{
+				Date:  "28/01/2024",
+				Title: "Заголовок",
+			},
+			wantTask: &task{
+				Date:  "28/01/2024",
+				Title: "Заголовок",
+			},
+			wantErr: nextdate.ErrTaskDateFormat,
+		},
 		// Add more test cases here
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.task.checkTask()
+			err := tt.task.checkTask(time.Now())
 			if err != nil && tt.wantErr != nil {
 				if err.Error() != tt.wantErr.Error() {
 					t.Errorf("checkTask() error = %v, wantErr %v", err, tt.wantErr)
@@ -268,3 +371,214 @@ func TestCheckTask2(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckTaskTimezone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		task     task
+		wantDate string
+	}{
+		{
+			// В Нью-Йорке ещё 3 ноября, а по UTC уже 4-е: задача на сегодня не должна переноситься.
+			name:     "late evening, UTC is already tomorrow",
+			now:      time.Date(2024, 11, 3, 23, 30, 0, 0, newYork),
+			task:     task{Date: "20241103", Title: "Задача", Repeat: "d 1"},
+			wantDate: "20241103",
+		},
+		{
+			name:     "late evening, past task",
+			now:      time.Date(2024, 11, 3, 23, 30, 0, 0, newYork),
+			task:     task{Date: "20241101", Title: "Задача", Repeat: "d 1"},
+			wantDate: "20241104",
+		},
+		{
+			name:     "empty date is today in user zone",
+			now:      time.Date(2024, 11, 3, 23, 30, 0, 0, newYork),
+			task:     task{Title: "Задача"},
+			wantDate: "20241103",
+		},
+		{
+			// День перехода на летнее время короче 24 часов.
+			name:     "DST start, time passed",
+			now:      time.Date(2024, 3, 31, 10, 0, 0, 0, berlin),
+			task:     task{Date: "20240331", Time: "09:00", Title: "Задача", Repeat: "d 1"},
+			wantDate: "20240401",
+		},
+		{
+			name:     "DST start, time not passed",
+			now:      time.Date(2024, 3, 31, 10, 0, 0, 0, berlin),
+			task:     task{Date: "20240331", Time: "11:00", Title: "Задача", Repeat: "d 1"},
+			wantDate: "20240331",
+		},
+		{
+			// День перехода на зимнее время длиннее 24 часов.
+			name:     "DST end, just before midnight",
+			now:      time.Date(2024, 10, 27, 23, 59, 0, 0, berlin),
+			task:     task{Date: "20241026", Title: "Задача", Repeat: "d 1"},
+			wantDate: "20241028",
+		},
+		{
+			name:     "DST end, right after midnight",
+			now:      time.Date(2024, 10, 28, 0, 1, 0, 0, berlin),
+			task:     task{Date: "20241026", Title: "Задача", Repeat: "d 1"},
+			wantDate: "20241029",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.task.checkTask(tt.now); err != nil {
+				t.Fatalf("checkTask() error = %v", err)
+			}
+			if tt.task.Date != tt.wantDate {
+				t.Errorf("checkTask() date = %v, want %v", tt.task.Date, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestRequestNow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set(timezoneHeader, "Asia/Tokyo")
+	now, err := requestNow(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now.Location().String() != "Asia/Tokyo" {
+		t.Errorf("requestNow() location = %v, want Asia/Tokyo", now.Location())
+	}
+
+	c.Request.Header.Set(timezoneHeader, "Mars/Olympus")
+	if _, err := requestNow(c); err == nil {
+		t.Error("requestNow() expected error for unknown time zone")
+	}
+}
+
+func TestUpdateTaskNormalizes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := database.NewMemory()
+	ctx := context.Background()
+	_, err := storage.AddTaskDB(ctx, models.DBTask{Date: "20240201", Title: "Задача"})
+	require.NoError(t, err)
+	h := NewHandler(storage)
+
+	// Дата вычисляется по часам сервера, поэтому около полуночи подходит и завтрашний день следующих суток.
+	before := time.Now().AddDate(0, 0, 1).Format("20060102")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/task", strings.NewReader(`{"id":"1","date":"завтра","title":"Задача","repeat":"d 1"}`))
+	h.UpdateTask(c)
+	after := time.Now().AddDate(0, 0, 1).Format("20060102")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	task, err := storage.FindTask(ctx, "1")
+	require.NoError(t, err)
+	assert.Contains(t, []string{before, after}, task.Date)
+	assert.Equal(t, string(nextdate.AnchorSchedule), task.Anchor)
+	assert.Equal(t, "d 1", task.Repeat)
+}
+
+func TestUpdateTaskKeepsMissingFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := database.NewMemory()
+	ctx := context.Background()
+	date := time.Now().AddDate(0, 0, 3).Format("20060102")
+	endDate := time.Now().AddDate(1, 0, 0).Format("20060102")
+	_, err := storage.AddTaskDB(ctx, models.DBTask{
+		Date:     date,
+		Time:     "09:30",
+		Title:    "Задача",
+		Repeat:   "d 7",
+		Anchor:   string(nextdate.AnchorCompletion),
+		EndDate:  endDate,
+		MaxCount: 5,
+	})
+	require.NoError(t, err)
+	h := NewHandler(storage)
+
+	put := func(body string) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/task", strings.NewReader(body))
+		h.UpdateTask(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Веб-интерфейс отправляет только поля своей формы.
+	put(`{"id":"1","date":"` + date + `","title":"Новый заголовок","comment":"","repeat":"d 7"}`)
+	task, err := storage.FindTask(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Новый заголовок", task.Title)
+	assert.Equal(t, "09:30", task.Time)
+	assert.Equal(t, string(nextdate.AnchorCompletion), task.Anchor)
+	assert.Equal(t, endDate, task.EndDate)
+	assert.Equal(t, 5, task.MaxCount)
+
+	// Переданное пустое значение поле очищает.
+	put(`{"id":"1","date":"` + date + `","title":"Новый заголовок","repeat":"d 7","time":"","max_count":0}`)
+	task, err = storage.FindTask(ctx, "1")
+	require.NoError(t, err)
+	assert.Empty(t, task.Time)
+	assert.Zero(t, task.MaxCount)
+	assert.Equal(t, endDate, task.EndDate)
+}
+
+// TestAddTaskPastMaxCount проверяет, что повторения, пропущенные при переносе даты задачи из прошлого,
+// засчитываются в max_count, а серию, в которой повторений не осталось, сохранить нельзя.
+func TestAddTaskPastMaxCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := database.NewMemory()
+	ctx := context.Background()
+	h := NewHandler(storage)
+
+	// Прошли повторения 20, 13 и 6 дней назад, следующее — завтра.
+	date := time.Now().AddDate(0, 0, -20).Format("20060102")
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("20060102")
+	send := func(handle gin.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, "/api/task", strings.NewReader(body))
+		handle(c)
+		return w
+	}
+
+	w := send(h.AddTask, http.MethodPost, `{"date":"`+date+`","title":"Курс","repeat":"d 7","max_count":5}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	task, err := storage.FindTask(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, tomorrow, task.Date)
+	assert.Equal(t, 3, task.DoneCount)
+
+	w = send(h.AddTask, http.MethodPost, `{"date":"`+date+`","title":"Курс","repeat":"d 7","max_count":3}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "прошли все повторения серии")
+
+	// У просроченной задачи при изменении засчитывается и повторение, которое её дата уже пропустила.
+	overdue := time.Now().AddDate(0, 0, -6).Format("20060102")
+	_, err = storage.AddTaskDB(ctx, models.DBTask{Date: overdue, Title: "Зарядка", Repeat: "d 7", MaxCount: 3, DoneCount: 1})
+	require.NoError(t, err)
+	w = send(h.UpdateTask, http.MethodPut, `{"id":"2","date":"`+overdue+`","title":"Зарядка","repeat":"d 7"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	task, err = storage.FindTask(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, tomorrow, task.Date)
+	assert.Equal(t, 2, task.DoneCount)
+
+	_, err = storage.AddTaskDB(ctx, models.DBTask{Date: overdue, Title: "Зарядка", Repeat: "d 7", MaxCount: 2, DoneCount: 1})
+	require.NoError(t, err)
+	w = send(h.UpdateTask, http.MethodPut, `{"id":"3","date":"`+overdue+`","title":"Зарядка","repeat":"d 7"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/gommon/log"
+	"github.com/vova4o/go_final_project/internal/models"
+	"github.com/vova4o/go_final_project/internal/nextdate"
+)
+
+// maxCalendarDays — наибольшая длина интервала, который можно запросить в календаре.
+const maxCalendarDays = 366
+
+// calendarEntry — задача в календаре. Virtual отмечает повторение, которого нет в базе:
+// у него дата повторения, а остальные поля — как у сохранённой задачи.
+type calendarEntry struct {
+	models.DBTask
+	Virtual bool `json:"virtual"`
+}
+
+// calendarDay — задачи одного дня календаря.
+type calendarDay struct {
+	Date  string          `json:"date"`
+	Tasks []calendarEntry `json:"tasks"`
+}
+
+// Calendar возвращает все задачи и их повторения в интервале from–to включительно, сгруппированные по дням.
+// Даты можно указывать так же, как дату задачи: 20060102, завтра, +7d.
+func (h *Handler) Calendar(c *gin.Context) {
+	now, err := requestNow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, err := nextdate.ParseDate(c.Query("from"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from: " + err.Error()})
+		return
+	}
+	to, err := nextdate.ParseDate(c.Query("to"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to: " + err.Error()})
+		return
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "дата to раньше даты from"})
+		return
+	}
+	if to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("интервал календаря не может быть длиннее %d дней", maxCalendarDays)})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	tasks, err := h.Storage.TasksUntil(ctx, to.Format("20060102"))
+	if err != nil {
+		storageError(c, ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	days := expandCalendar(tasks, from, to)
+
+	c.JSON(http.StatusOK, gin.H{
+		"from": from.Format("20060102"),
+		"to":   to.Format("20060102"),
+		"days": days,
+	})
+}
+
+// expandCalendar раскладывает задачи и их повторения по дням интервала from–to.
+// Повторения по правилам h и min показываются одной записью в день. Задача, правило которой
+// не удаётся разобрать, показывается только на свою дату.
+func expandCalendar(tasks []models.DBTask, from, to time.Time) []calendarDay {
+	fromStr, toStr := from.Format("20060102"), to.Format("20060102")
+	byDate := make(map[string][]calendarEntry)
+
+	for _, task := range tasks {
+		if task.Date >= fromStr && task.Date <= toStr {
+			byDate[task.Date] = append(byDate[task.Date], calendarEntry{DBTask: task})
+		}
+		if task.Repeat == "" {
+			continue
+		}
+
+		limit := nextdate.Limit{EndDate: task.EndDate}
+		if task.MaxCount > 0 {
+			// Дата задачи — первое из оставшихся повторений серии.
+			limit.MaxCount = max(task.MaxCount-task.DoneCount, 1)
+		}
+		// Если дату задачи перенесли на рабочий день, повторения отсчитываются от даты до переноса,
+		// и сама дата задачи тогда оказывается первым повторением после неё.
+		start := task.Date
+		if task.SeriesDate != "" {
+			start = task.SeriesDate
+			if limit.MaxCount > 0 {
+				limit.MaxCount++
+			}
+		}
+		dates, err := nextdate.OccurrencesUntil(from.AddDate(0, 0, -1), start, task.Repeat, toStr, limit)
+		if err != nil {
+			log.Errorf("задача %s: %v", task.ID, err)
+			continue
+		}
+		for _, date := range dates {
+			if date <= task.Date {
+				continue
+			}
+			entry := calendarEntry{DBTask: task, Virtual: true}
+			entry.Date = date
+			byDate[date] = append(byDate[date], entry)
+		}
+	}
+
+	days := make([]calendarDay, 0, len(byDate))
+	for date, entries := range byDate {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Time < entries[j].Time
+		})
+		days = append(days, calendarDay{Date: date, Tasks: entries})
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+	return days
+}
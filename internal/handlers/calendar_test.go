@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+func TestExpandCalendar(t *testing.T) {
+	tasks := []models.DBTask{
+		{ID: "3", Date: "20240101", Title: "Полив", Repeat: "d 10", EndDate: "20240125"},
+		{ID: "5", Date: "20240120", Title: "Сломанное правило", Repeat: "x 1"},
+		{ID: "1", Date: "20240122", Time: "09:00", Title: "Планёрка", Repeat: "w 1,3"},
+		{ID: "4", Date: "20240124", Time: "08:00", Title: "Таблетки", Repeat: "d 2", MaxCount: 3, DoneCount: 1},
+		{ID: "2", Date: "20240125", Title: "Отчёт"},
+		// Дата серии выпала на субботу, и задачу перенесли на понедельник.
+		{ID: "6", Date: "20240129", SeriesDate: "20240127", Title: "Сверка", Repeat: "d 3 b+"},
+	}
+	from := time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)
+
+	got := make(map[string][]string)
+	var order []string
+	for _, day := range expandCalendar(tasks, from, to) {
+		order = append(order, day.Date)
+		for _, e := range day.Tasks {
+			if e.Date != day.Date {
+				t.Errorf("entry %s on %s has date %s", e.ID, day.Date, e.Date)
+			}
+			s := e.ID
+			if e.Virtual {
+				s += "*"
+			}
+			got[day.Date] = append(got[day.Date], s)
+		}
+	}
+
+	want := map[string][]string{
+		"20240122": {"1"},
+		"20240124": {"4", "1*"},
+		"20240125": {"2"},
+		"20240126": {"4*"},
+		"20240129": {"6", "1*"},
+		"20240130": {"6*"},
+		"20240131": {"1*"},
+		"20240202": {"6*"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandCalendar() = %v, want %v", got, want)
+	}
+	wantOrder := []string{"20240122", "20240124", "20240125", "20240126", "20240129", "20240130", "20240131", "20240202"}
+	if !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("expandCalendar() days = %v, want %v", order, wantOrder)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/gommon/log"
+)
+
+// dbTimeout — наибольшее время, которое обработчик ждёт хранилище задач за один запрос; 0 — без ограничения.
+var dbTimeout time.Duration
+
+// SetDBTimeout задаёт тайм-аут запросов к хранилищу. Вызывается при запуске сервера.
+func SetDBTimeout(d time.Duration) {
+	dbTimeout = d
+}
+
+// dbContext возвращает контекст для запросов к хранилищу. Он отменяется, когда клиент отключается
+// или сервер останавливается, а также по истечении dbTimeout.
+func dbContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx := c.Request.Context()
+	if dbTimeout > 0 {
+		return context.WithTimeout(ctx, dbTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// storageError отвечает на ошибку хранилища err. Если запрос прерван истечением тайм-аута, ответ — 504,
+// если отменён (клиент отключился или сервер останавливается) — 503, иначе — status.
+// Драйвер не всегда возвращает ошибку контекста как есть, поэтому проверяется и сам ctx.
+func storageError(c *gin.Context, ctx context.Context, err error, status int) {
+	log.Error(err)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "хранилище задач не ответило вовремя"})
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "запрос к хранилищу задач отменён"})
+	default:
+		c.JSON(status, gin.H{"error": err.Error()})
+	}
+}
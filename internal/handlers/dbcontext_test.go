@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowStorage — хранилище, которое удаляет задачу, только когда отменяется контекст запроса.
+type slowStorage struct {
+	Storager
+}
+
+func (slowStorage) DeleteTask(ctx context.Context, id string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStorageTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(slowStorage{})
+
+	defer SetDBTimeout(0)
+	SetDBTimeout(10 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/api/task?id=1", nil)
+	h.DeleteTask(c)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	// Клиент отключился раньше, чем истёк тайм-аут.
+	SetDBTimeout(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/api/task?id=1", nil).WithContext(ctx)
+	h.DeleteTask(c)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -4,7 +4,6 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/labstack/gommon/log"
 )
 
 // DeleteTask удаляет задачу по id
@@ -15,10 +14,12 @@ func (h *Handler) DeleteTask(c *gin.Context) {
 		return
 	}
 
-	err := h.Storage.DeleteTask(id)
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	err := h.Storage.DeleteTask(ctx, id)
 	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		storageError(c, ctx, err, http.StatusInternalServerError)
 		return
 	}
 
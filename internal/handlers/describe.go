@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vova4o/go_final_project/internal/nextdate"
+)
+
+// DescribeRepeat возвращает описание правила повторения обычной фразой на русском или английском (параметр lang).
+func DescribeRepeat(c *gin.Context) {
+	lang, err := nextdate.ParseLanguage(c.Query("lang"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	description, err := nextdate.DescribeRule(c.Query("repeat"), lang)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"description": description})
+}
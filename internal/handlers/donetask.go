@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/labstack/gommon/log"
 )
 
+// doneRequest — необязательное тело запроса на выполнение задачи.
+type doneRequest struct {
+	Note string `json:"note"` // комментарий к выполнению для истории
+}
+
 // DoneTask помечает задачу как выполненную по id, если задача не повторяющаяся, то удаляет ее из базы данных,
 // в противном случае устанавливает дату следующего выполнения и записывает в базу данных.
+// Выполнение записывается в историю вместе с комментарием note из тела запроса, если оно есть.
 func (h *Handler) DoneTask(c *gin.Context) {
 	id := c.Query("id")
 	if id == "" {
@@ -16,10 +23,24 @@ func (h *Handler) DoneTask(c *gin.Context) {
 		return
 	}
 
-	err := h.Storage.DoneTask(id)
+	var req doneRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now, err := requestNow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	err = h.Storage.DoneTask(ctx, id, now, req.Note)
 	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		storageError(c, ctx, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/vova4o/go_final_project/internal/database"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+// newTestHandler возвращает Handler над хранилищем в памяти, в которое по порядку добавлены задачи tasks
+// (их id — 1, 2…), и само хранилище.
+func newTestHandler(t *testing.T, tasks ...models.DBTask) (*Handler, *database.MemoryStorage) {
+	gin.SetMode(gin.TestMode)
+	storage := database.NewMemory()
+	for _, task := range tasks {
+		_, err := storage.AddTaskDB(context.Background(), task)
+		require.NoError(t, err)
+	}
+	return NewHandler(storage), storage
+}
+
+// call выполняет handler для запроса method к target с телом body и возвращает ответ.
+func call(handler gin.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	handler(c)
+	return w
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vova4o/go_final_project/internal/models"
+	"github.com/vova4o/go_final_project/internal/nextdate"
+)
+
+// TaskHistory возвращает записи о выполнении задачи по id, начиная с первой.
+func (h *Handler) TaskHistory(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан id"})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	history, err := h.Storage.TaskHistory(ctx, id)
+	if err != nil {
+		storageError(c, ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"completions": completionsResponse(history)})
+}
+
+// History возвращает записи о выполнении всех задач в интервале from–to включительно, начиная с первой.
+// Даты можно указывать так же, как дату задачи: 20060102, вчера, -7d. Без from или to интервал не ограничен с этой стороны.
+func (h *Handler) History(c *gin.Context) {
+	now, err := requestNow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var from, to string
+	if s := c.Query("from"); s != "" {
+		date, err := nextdate.ParseDate(s, now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from: " + err.Error()})
+			return
+		}
+		from = date.Format("20060102")
+	}
+	if s := c.Query("to"); s != "" {
+		date, err := nextdate.ParseDate(s, now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to: " + err.Error()})
+			return
+		}
+		to = date.Format("20060102")
+	}
+	if from != "" && to != "" && to < from {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "дата to раньше даты from"})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	history, err := h.Storage.History(ctx, from, to)
+	if err != nil {
+		storageError(c, ctx, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "completions": completionsResponse(history)})
+}
+
+// completionsResponse возвращает пустой список вместо nil, чтобы в ответе был массив, а не null.
+func completionsResponse(history []models.Completion) []models.Completion {
+	if history == nil {
+		return []models.Completion{}
+	}
+	return history
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+func TestHistory(t *testing.T) {
+	h, _ := newTestHandler(t, models.DBTask{Date: "20240201", Title: "Зарядка", Repeat: "d 1"})
+
+	completions := func(w *httptest.ResponseRecorder) []models.Completion {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Completions []models.Completion `json:"completions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Completions)
+		return resp.Completions
+	}
+
+	// Тело запроса необязательно.
+	assert.Equal(t, http.StatusOK, call(h.DoneTask, http.MethodPost, "/api/task/done?id=1", "").Code)
+	assert.Equal(t, http.StatusOK, call(h.DoneTask, http.MethodPost, "/api/task/done?id=1", `{"note": "через силу"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, call(h.DoneTask, http.MethodPost, "/api/task/done?id=1", `{"note": 1}`).Code)
+
+	history := completions(call(h.TaskHistory, http.MethodGet, "/api/task/history?id=1", ""))
+	require.Len(t, history, 2)
+	assert.Equal(t, "1", history[0].TaskID)
+	assert.Empty(t, history[0].Note)
+	assert.Equal(t, "через силу", history[1].Note)
+	assert.Empty(t, completions(call(h.TaskHistory, http.MethodGet, "/api/task/history?id=2", "")))
+	assert.Equal(t, http.StatusBadRequest, call(h.TaskHistory, http.MethodGet, "/api/task/history", "").Code)
+
+	assert.Len(t, completions(call(h.History, http.MethodGet, "/api/history?from=today&to=today", "")), 2)
+	assert.Len(t, completions(call(h.History, http.MethodGet, "/api/history", "")), 2)
+	assert.Empty(t, completions(call(h.History, http.MethodGet, "/api/history?to=yesterday", "")))
+	assert.Empty(t, completions(call(h.History, http.MethodGet, "/api/history?from=tomorrow", "")))
+	for _, query := range []string{"?from=abc", "?to=abc", "?from=tomorrow&to=today"} {
+		assert.Equal(t, http.StatusBadRequest, call(h.History, http.MethodGet, "/api/history"+query, "").Code, query)
+	}
+}
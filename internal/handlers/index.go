@@ -15,6 +15,7 @@ func SetupRoutes(mux *gin.Engine, h *Handler) {
 	mux.GET("/", Index)
 	mux.POST("/api/signin", SignIn)
 	mux.GET("/api/nextdate", NextDate)
+	mux.GET("/api/repeat/describe", DescribeRepeat)
 
 	//	hendlers will go here
 	api := mux.Group("/api")
@@ -25,6 +26,14 @@ func SetupRoutes(mux *gin.Engine, h *Handler) {
 	api.DELETE("/task", h.DeleteTask)  // to midleware
 	api.POST("/task/done", h.DoneTask) // to midleware
 	api.GET("/tasks", h.Tasks)         // to midleware
+	api.GET("/task/history", h.TaskHistory)
+	api.GET("/task/revisions", h.TaskRevisions)
+	api.POST("/task/revisions/restore", h.RestoreRevision)
+	api.GET("/calendar", h.Calendar)
+	api.GET("/history", h.History)
+	api.GET("/trash", h.Trash)
+	api.POST("/trash/restore", h.RestoreTask)
+	api.DELETE("/trash", h.EmptyTrash)
 }
 
 func Index(c *gin.Context) {
@@ -1,21 +1,37 @@
 package handlers
 
 import (
+	"context"
+	"time"
+
 	"github.com/vova4o/go_final_project/internal/database"
 	"github.com/vova4o/go_final_project/internal/models"
 )
 
-var _ Storager = &database.Storage{}
+var (
+	_ Storager = &database.Storage{}
+	_ Storager = &database.MemoryStorage{}
+)
 
 type Storager interface {
 	InitDB() error
 	CloseDB()
-	AddTaskDB(date string, title string, comment string, repeat string) (int64, error)
-	FindTask(id string) (models.DBTask, error)
-	UpdateTask(task models.DBTask) error
-	Tasks(offset int) ([]models.DBTask, error)
-	SearchTasks(search string) ([]models.DBTask, error)
-	TasksByDate(date string) ([]models.DBTask, error)
-	DoneTask(id string) error
-	DeleteTask(id string) error
+	AddTaskDB(ctx context.Context, task models.DBTask) (int64, error)
+	FindTask(ctx context.Context, id string) (models.DBTask, error)
+	UpdateTask(ctx context.Context, task models.DBTask) error
+	TaskRevisions(ctx context.Context, id string) ([]models.Revision, error)
+	RestoreRevision(ctx context.Context, id string, revision string) error
+	Tasks(ctx context.Context, page models.Page) (models.TaskPage, error)
+	SearchTasks(ctx context.Context, search string, page models.Page) (models.TaskPage, error)
+	TasksByDate(ctx context.Context, date string, page models.Page) (models.TaskPage, error)
+	TasksUntil(ctx context.Context, date string) ([]models.DBTask, error)
+	DoneTask(ctx context.Context, id string, now time.Time, note string) error
+	TaskHistory(ctx context.Context, id string) ([]models.Completion, error)
+	History(ctx context.Context, from, to string) ([]models.Completion, error)
+	DeleteTask(ctx context.Context, id string) error
+	TrashTasks(ctx context.Context) ([]models.TrashTask, error)
+	RestoreTask(ctx context.Context, id string) error
+	RemoveFromTrash(ctx context.Context, id string) error
+	EmptyTrash(ctx context.Context) (int64, error)
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
 }
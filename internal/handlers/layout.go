@@ -0,0 +1,62 @@
+package handlers
+
+import "strings"
+
+// Раскладки клавиатуры, в которых мог быть набран поисковый запрос.
+const (
+	layoutRU = "ru" // ЙЦУКЕН
+	layoutEN = "en" // QWERTY
+)
+
+// qwertyKeys и jcukenKeys — символы на одних и тех же клавишах в раскладках QWERTY и ЙЦУКЕН.
+const (
+	qwertyKeys = "qwertyuiop[]asdfghjkl;'zxcvbnm,.`QWERTYUIOP{}ASDFGHJKL:\"ZXCVBNM<>~"
+	jcukenKeys = "йцукенгшщзхъфывапролджэячсмитьбюёЙЦУКЕНГШЩЗХЪФЫВАПРОЛДЖЭЯЧСМИТЬБЮЁ"
+)
+
+var (
+	toJcuken = keyMap(qwertyKeys, jcukenKeys)
+	toQwerty = keyMap(jcukenKeys, qwertyKeys)
+)
+
+func keyMap(from, to string) map[rune]rune {
+	src, dst := []rune(from), []rune(to)
+	m := make(map[rune]rune, len(src))
+	for i, r := range src {
+		m[r] = dst[i]
+	}
+	return m
+}
+
+// switchLayout возвращает текст, который получился бы, если набрать те же клавиши в другой раскладке,
+// и раскладку, в которой он прочитан: текст латиницей читается как набранный в ЙЦУКЕН («ghbdtn» — «привет»),
+// а кириллицей — как набранный в QWERTY («ршпрщ» — «higho»). Раскладка выбирается по тому, каких букв
+// в тексте больше. Если в тексте нет букв, которые можно перевести, возвращается пустая строка.
+func switchLayout(s string) (string, string) {
+	latin, cyrillic := 0, 0
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			latin++
+		case toQwerty[r] != 0:
+			cyrillic++
+		}
+	}
+
+	keys, layout := toJcuken, layoutRU
+	switch {
+	case latin == 0 && cyrillic == 0:
+		return "", ""
+	case cyrillic > latin:
+		keys, layout = toQwerty, layoutEN
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		if k, ok := keys[r]; ok {
+			r = k
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), layout
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwitchLayout(t *testing.T) {
+	tests := []struct {
+		s      string
+		want   string
+		layout string
+	}{
+		{"ghbdtn", "привет", layoutRU},
+		{"Regbnm [kt,", "Купить хлеб", layoutRU},
+		{"ntktdbpjh", "телевизор", layoutRU},
+		{"руддщ", "hello", layoutEN},
+		{"Ршпр ЫЩ", "High SO", layoutEN},
+		{"123 - 45", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		got, layout := switchLayout(tt.s)
+		assert.Equal(t, tt.want, got, tt.s)
+		assert.Equal(t, tt.layout, layout, tt.s)
+	}
+}
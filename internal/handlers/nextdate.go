@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/vova4o/go_final_project/internal/nextdate"
 )
 
-// NextDate возвращает следующую дату, когда нужно выполнить задачу в соответствии с заданной датой и периодичностью
+// NextDate возвращает следующую дату, когда нужно выполнить задачу в соответствии с заданной датой и периодичностью.
+// С параметром count возвращает JSON-массив из count ближайших дат, с параметром until — все даты до until включительно.
+// Параметры end_date и max_count задают окончание серии; если дат в серии не осталось, возвращается пустой ответ.
 func NextDate(c *gin.Context) {
 	nowStr := c.Query("now")
 	date := c.Query("date")
@@ -20,8 +24,57 @@ func NextDate(c *gin.Context) {
 		return
 	}
 
-	next, err := nextdate.NextDate(now, date, repeat)
+	// Условия окончания серии: последняя дата и число повторений, считая дату задачи.
+	limit := nextdate.Limit{EndDate: c.Query("end_date")}
+	if maxCount, ok := c.GetQuery("max_count"); ok {
+		limit.MaxCount, err = strconv.Atoi(maxCount)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_count должен быть числом"})
+			return
+		}
+	}
+	if err := limit.Check(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if countStr, ok := c.GetQuery("count"); ok {
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count должен быть числом"})
+			return
+		}
+		dates, err := nextdate.Occurrences(now, date, repeat, count, limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, dates)
+		return
+	}
+
+	if until, ok := c.GetQuery("until"); ok {
+		dates, err := nextdate.OccurrencesUntil(now, date, repeat, until, limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, dates)
+		return
+	}
+
+	next, err := nextdate.NextDateLimited(now, date, repeat, limit)
+	if errors.Is(err, nextdate.ErrNoOccurrence) {
+		// Серия закончилась: следующей даты нет.
+		c.String(http.StatusOK, "")
+		return
+	}
 	if err != nil {
+		var ruleErr *nextdate.RuleError
+		if errors.As(err, &ruleErr) {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
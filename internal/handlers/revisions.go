@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vova4o/go_final_project/internal/database"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+// TaskRevisions возвращает версии задачи по id, начиная с исходной: у каждой есть изменённые поля
+// с прежними и новыми значениями, время изменения и задача после изменения.
+func (h *Handler) TaskRevisions(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан id"})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	revisions, err := h.Storage.TaskRevisions(ctx, id)
+	if err != nil {
+		storageError(c, ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if revisions == nil {
+		revisions = []models.Revision{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// RestoreRevision возвращает задачу по id к версии revision. Восстановление появляется в списке версий как новая версия.
+func (h *Handler) RestoreRevision(c *gin.Context) {
+	id := c.Query("id")
+	revision := c.Query("revision")
+	if id == "" || revision == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан id задачи или версии"})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	err := h.Storage.RestoreRevision(ctx, id, revision)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, database.ErrTaskNotFound) || errors.Is(err, database.ErrRevisionNotFound) {
+			status = http.StatusNotFound
+		}
+		storageError(c, ctx, err, status)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
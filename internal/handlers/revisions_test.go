@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+func TestRevisions(t *testing.T) {
+	h, storage := newTestHandler(t, models.DBTask{Date: "20240201", Title: "Старый заголовок"})
+	ctx := context.Background()
+	require.NoError(t, storage.UpdateTask(ctx, models.DBTask{ID: "1", Date: "20240201", Title: "Новый заголовок"}))
+
+	revisions := func(id string) []models.Revision {
+		w := call(h.TaskRevisions, http.MethodGet, "/api/task/revisions?id="+id, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Revisions []models.Revision `json:"revisions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Revisions)
+		return resp.Revisions
+	}
+
+	list := revisions("1")
+	require.Len(t, list, 2)
+	assert.Equal(t, []models.FieldChange{{Field: "title", Old: "Старый заголовок", New: "Новый заголовок"}}, list[1].Changes)
+	assert.Empty(t, revisions("2"))
+
+	assert.Equal(t, http.StatusOK, call(h.RestoreRevision, http.MethodPost, "/api/task/revisions/restore?id=1&revision="+list[0].ID, "").Code)
+	task, err := storage.FindTask(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Старый заголовок", task.Title)
+	assert.Len(t, revisions("1"), 3)
+
+	assert.Equal(t, http.StatusNotFound, call(h.RestoreRevision, http.MethodPost, "/api/task/revisions/restore?id=1&revision=100", "").Code)
+	assert.Equal(t, http.StatusBadRequest, call(h.RestoreRevision, http.MethodPost, "/api/task/revisions/restore?id=1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, call(h.TaskRevisions, http.MethodGet, "/api/task/revisions", "").Code)
+
+	require.NoError(t, storage.DeleteTask(ctx, "1"))
+	assert.Equal(t, http.StatusNotFound, call(h.RestoreRevision, http.MethodPost, "/api/task/revisions/restore?id=1&revision="+list[0].ID, "").Code)
+}
@@ -1,63 +1,149 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/labstack/gommon/log"
+	"github.com/vova4o/go_final_project/internal/database"
 	"github.com/vova4o/go_final_project/internal/models"
+	"github.com/vova4o/go_final_project/internal/nextdate"
 )
 
-// Tasks возвращает последниее 10 задач из базы данных. Оставил возможность указать смещение, но не использую его.
+// Tasks возвращает страницу списка задач или результаты поиска из параметра search по тексту или дате.
+// Формат ответа описан в README.
 func (h *Handler) Tasks(c *gin.Context) {
 	search, searchExists := c.GetQuery("search")
-	var tasks []models.DBTask
-	var err error
+	var result models.TaskPage
 
+	page, paged, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	// Раскладка и текст, по которым нашлись задачи, если запрос был набран не в той раскладке.
+	var layout, layoutSearch string
 	if !searchExists {
-		offset := 0
-		tasks, err = h.Storage.Tasks(offset)
+		result, err = h.Storage.Tasks(ctx, page)
+	} else {
+		var now time.Time
+		now, err = requestNow(c)
 		if err != nil {
-			log.Error(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-	} else {
-		parsedDate, err := time.Parse("02.01.2006", search)
-		if err != nil {
-			// The search query is not a date, so perform a string search.
-			tasks, err = h.Storage.SearchTasks(search)
-			if err != nil {
-				log.Error(err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+		// Поиск по дате принимает те же выражения, что и дата задачи: 02.01.2006, завтра, next friday.
+		// Если на эту дату задач нет, запрос ищется как текст: «пт» или «сегодня» могут быть и в заголовке.
+		dated := false
+		if parsedDate, dateErr := nextdate.ParseDate(search, now); dateErr == nil {
+			result, err = h.Storage.TasksByDate(ctx, parsedDate.Format("20060102"), page)
+			if errors.Is(err, database.ErrInvalidCursor) {
+				// Курсор мог остаться от страницы текстового поиска.
+				err = nil
 			}
-		} else {
-			// The search query is a date.
-			tasks, err = h.Storage.TasksByDate(parsedDate.Format("20060102"))
-			if err != nil {
-				log.Error(err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+			dated = err != nil || result.Total > 0
+		}
+		if !dated {
+			// The search query is not a date, so perform a string search.
+			result, err = h.Storage.SearchTasks(ctx, search, page)
+			if err == nil && result.Total == 0 {
+				// Ничего не нашлось: возможно, запрос набран не в той раскладке, например «ghbdtn» вместо «привет».
+				if switched, l := switchLayout(search); switched != "" && switched != search {
+					var retry models.TaskPage
+					retry, err = h.Storage.SearchTasks(ctx, switched, page)
+					if err == nil && retry.Total > 0 {
+						result, layout, layoutSearch = retry, l, switched
+					}
+				}
 			}
 		}
 	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, database.ErrInvalidCursor) {
+			status = http.StatusBadRequest
+		}
+		storageError(c, ctx, err, status)
+		return
+	}
 
+	tasks := result.Tasks
 	if tasks == nil {
 		tasks = []models.DBTask{}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+	resp := gin.H{"tasks": tasks}
+	if len(result.Snippets) == len(result.Tasks) && len(result.Snippets) > 0 {
+		// Результаты полнотекстового поиска отдаются вместе с фрагментами текста.
+		found := make([]searchResult, len(result.Tasks))
+		for i, t := range result.Tasks {
+			found[i] = searchResult{DBTask: t, Snippet: result.Snippets[i]}
+		}
+		resp["tasks"] = found
+	}
+	if layout != "" {
+		resp["search"] = layoutSearch
+		resp["layout"] = layout
+	}
+	if paged {
+		resp["next_cursor"] = result.NextCursor
+		resp["total"] = result.Total
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// parsePage возвращает страницу списка из параметров запроса limit и cursor
+// и сообщает, передал ли клиент хотя бы один из них.
+func parsePage(c *gin.Context) (models.Page, bool, error) {
+	var page models.Page
+	limit, hasLimit := c.GetQuery("limit")
+	cursor, hasCursor := c.GetQuery("cursor")
+	if hasLimit {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > database.MaxLimit {
+			return page, false, fmt.Errorf("limit должен быть числом от 1 до %d", database.MaxLimit)
+		}
+		page.Limit = n
+	}
+	page.After = cursor
+	return page, hasLimit || hasCursor, nil
+}
+
+// searchResult — задача, найденная полнотекстовым поиском, с фрагментом текста, в котором
+// найденные слова выделены тегом <mark>.
+type searchResult struct {
+	models.DBTask
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// taskResponse — задача вместе с описанием её правила повторения.
+type taskResponse struct {
+	models.DBTask
+	Description string `json:"description,omitempty"`
 }
 
 // FindTask возвращает задачу по id
 func (h *Handler) FindTask(c *gin.Context) {
+	lang, err := nextdate.ParseLanguage(c.Query("lang"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
 	search := c.Query("id")
-	task, err := h.Storage.FindTask(search)
+	task, err := h.Storage.FindTask(ctx, search)
 	if err != nil {
-		log.Error(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		storageError(c, ctx, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -66,5 +152,11 @@ func (h *Handler) FindTask(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, task)
+	resp := taskResponse{DBTask: task}
+	if task.Repeat != "" {
+		// Если в базе осталось правило, которое уже не разбирается, задачу всё равно отдаём, только без описания.
+		resp.Description, _ = nextdate.DescribeRule(task.Repeat, lang)
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vova4o/go_final_project/internal/database"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+func TestTasksPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := database.NewMemory()
+	for i := 1; i <= 12; i++ {
+		_, err := storage.AddTaskDB(context.Background(), models.DBTask{Date: "202402" + strconv.Itoa(i+10), Title: "Задача " + strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+	h := NewHandler(storage)
+
+	get := func(query string) (int, map[string]json.RawMessage) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/tasks"+query, nil)
+		h.Tasks(c)
+		var resp map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	// Без параметров страницы ответ прежний: только первые 10 задач.
+	code, resp := get("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp, 1)
+	var tasks []models.DBTask
+	require.NoError(t, json.Unmarshal(resp["tasks"], &tasks))
+	assert.Len(t, tasks, database.DefaultLimit)
+
+	code, resp = get("?limit=5")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, "12", string(resp["total"]))
+	var cursor string
+	require.NoError(t, json.Unmarshal(resp["next_cursor"], &cursor))
+	assert.NotEmpty(t, cursor)
+
+	code, resp = get("?limit=10&cursor=" + cursor)
+	assert.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(resp["tasks"], &tasks))
+	assert.Len(t, tasks, 7)
+	assert.Equal(t, "Задача 6", tasks[0].Title)
+	assert.JSONEq(t, `""`, string(resp["next_cursor"]))
+
+	code, resp = get("?search=Задача&limit=3")
+	assert.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(resp["tasks"], &tasks))
+	assert.Len(t, tasks, 3)
+	assert.JSONEq(t, "12", string(resp["total"]))
+
+	for _, query := range []string{"?limit=0", "?limit=1000", "?limit=abc", "?cursor=abc!"} {
+		code, _ = get(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestTasksSearchLayout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := database.NewMemory()
+	for _, title := range []string{"Купить ёлку", "Call Bob"} {
+		_, err := storage.AddTaskDB(context.Background(), models.DBTask{Date: "20240201", Title: title})
+		require.NoError(t, err)
+	}
+	h := NewHandler(storage)
+
+	search := func(text string) map[string]json.RawMessage {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/tasks?search="+url.QueryEscape(text), nil)
+		h.Tasks(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	tests := []struct {
+		text   string
+		title  string
+		search string
+		layout string
+	}{
+		{"КУПИТЬ елку", "Купить ёлку", "", ""},
+		{"regbnm", "Купить ёлку", "купить", "ru"},
+		{"сфдд", "Call Bob", "call", "en"},
+		{"нет такой", "", "", ""},
+	}
+	for _, tt := range tests {
+		resp := search(tt.text)
+		var tasks []models.DBTask
+		require.NoError(t, json.Unmarshal(resp["tasks"], &tasks))
+		if tt.title == "" {
+			assert.Empty(t, tasks, tt.text)
+			assert.Len(t, resp, 1, tt.text)
+			continue
+		}
+		require.Len(t, tasks, 1, tt.text)
+		assert.Equal(t, tt.title, tasks[0].Title, tt.text)
+		if tt.layout == "" {
+			assert.Len(t, resp, 1, tt.text)
+			continue
+		}
+		assert.JSONEq(t, strconv.Quote(tt.search), string(resp["search"]), tt.text)
+		assert.JSONEq(t, strconv.Quote(tt.layout), string(resp["layout"]), tt.text)
+	}
+}
+
+func TestTasksSearchDateWords(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := database.NewMemory()
+	for _, title := range []string{"Сделать сегодня", "Отчёт в пт", "Без даты"} {
+		_, err := storage.AddTaskDB(context.Background(), models.DBTask{Date: "20240201", Title: title})
+		require.NoError(t, err)
+	}
+	h := NewHandler(storage)
+
+	search := func(text string) []models.DBTask {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/tasks?search="+url.QueryEscape(text), nil)
+		h.Tasks(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Tasks []models.DBTask `json:"tasks"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Tasks
+	}
+
+	// На дату есть задачи — ищется по дате.
+	assert.Len(t, search("01.02.2024"), 3)
+	// На сегодня и ближайшую пятницу задач нет, поэтому слова ищутся в тексте.
+	for text, title := range map[string]string{"сегодня": "Сделать сегодня", "пт": "Отчёт в пт"} {
+		tasks := search(text)
+		require.Len(t, tasks, 1, text)
+		assert.Equal(t, title, tasks[0].Title, text)
+	}
+	assert.Empty(t, search("sun"))
+}
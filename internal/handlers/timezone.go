@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timezoneHeader — заголовок запроса, в котором клиент может передать свой часовой пояс, например Europe/Moscow.
+const timezoneHeader = "X-Timezone"
+
+// location — часовой пояс, в котором считается сегодняшняя дата, если клиент не передал свой.
+var location = time.Local
+
+// SetLocation задаёт часовой пояс по умолчанию. Вызывается при запуске сервера.
+func SetLocation(loc *time.Location) {
+	if loc == nil {
+		loc = time.Local
+	}
+	location = loc
+}
+
+// requestNow возвращает текущее время в часовом поясе запроса: из заголовка X-Timezone
+// или, если заголовка нет, в часовом поясе по умолчанию.
+func requestNow(c *gin.Context) (time.Time, error) {
+	name := c.GetHeader(timezoneHeader)
+	if name == "" {
+		return time.Now().In(location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("неизвестный часовой пояс %q", name)
+	}
+	return time.Now().In(loc), nil
+}
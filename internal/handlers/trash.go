@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vova4o/go_final_project/internal/database"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+// Trash возвращает задачи из корзины, начиная с удалённых последними. У каждой задачи есть время удаления deleted_at.
+func (h *Handler) Trash(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	tasks, err := h.Storage.TrashTasks(ctx)
+	if err != nil {
+		storageError(c, ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if tasks == nil {
+		tasks = []models.TrashTask{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+}
+
+// RestoreTask возвращает задачу по id из корзины в список задач.
+func (h *Handler) RestoreTask(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан id"})
+		return
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	err := h.Storage.RestoreTask(ctx, id)
+	if err != nil {
+		storageError(c, ctx, err, trashStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// EmptyTrash удаляет навсегда задачу по id из корзины, а без id — все задачи в корзине.
+func (h *Handler) EmptyTrash(c *gin.Context) {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var err error
+	if id := c.Query("id"); id != "" {
+		err = h.Storage.RemoveFromTrash(ctx, id)
+	} else {
+		_, err = h.Storage.EmptyTrash(ctx)
+	}
+	if err != nil {
+		storageError(c, ctx, err, trashStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func trashStatus(err error) int {
+	if errors.Is(err, database.ErrNotInTrash) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
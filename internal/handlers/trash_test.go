@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vova4o/go_final_project/internal/models"
+)
+
+func TestTrash(t *testing.T) {
+	h, storage := newTestHandler(t, models.DBTask{Date: "20240201", Title: "Первая"}, models.DBTask{Date: "20240201", Title: "Вторая"})
+
+	trash := func() []models.TrashTask {
+		w := call(h.Trash, http.MethodGet, "/api/trash", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Tasks []models.TrashTask `json:"tasks"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Tasks)
+		return resp.Tasks
+	}
+
+	assert.Empty(t, trash())
+
+	assert.Equal(t, http.StatusOK, call(h.DeleteTask, http.MethodDelete, "/api/task?id=1", "").Code)
+	assert.Equal(t, http.StatusOK, call(h.DeleteTask, http.MethodDelete, "/api/task?id=2", "").Code)
+	tasks := trash()
+	require.Len(t, tasks, 2)
+	assert.Equal(t, "Первая", tasks[1].Title)
+	assert.NotEmpty(t, tasks[1].DeletedAt)
+
+	assert.Equal(t, http.StatusOK, call(h.RestoreTask, http.MethodPost, "/api/trash/restore?id=1", "").Code)
+	task, err := storage.FindTask(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Первая", task.Title)
+	assert.Equal(t, http.StatusNotFound, call(h.RestoreTask, http.MethodPost, "/api/trash/restore?id=1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, call(h.RestoreTask, http.MethodPost, "/api/trash/restore", "").Code)
+
+	assert.Equal(t, http.StatusNotFound, call(h.EmptyTrash, http.MethodDelete, "/api/trash?id=1", "").Code)
+	assert.Equal(t, http.StatusOK, call(h.EmptyTrash, http.MethodDelete, "/api/trash?id=2", "").Code)
+	assert.Empty(t, trash())
+
+	assert.Equal(t, http.StatusOK, call(h.DeleteTask, http.MethodDelete, "/api/task?id=1", "").Code)
+	assert.Equal(t, http.StatusOK, call(h.EmptyTrash, http.MethodDelete, "/api/trash", "").Code)
+	assert.Empty(t, trash())
+}
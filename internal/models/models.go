@@ -2,9 +2,67 @@ package models
 
 // DBTask описывает структуру зранения данных в базе данных
 type DBTask struct {
-	ID      string `db:"id" json:"id"`
-	Date    string `db:"date" json:"date"`
-	Title   string `db:"title" json:"title"`
-	Comment string `db:"comment" json:"comment"`
-	Repeat  string `db:"repeat" json:"repeat"`
+	ID         string `db:"id" json:"id"`
+	Date       string `db:"date" json:"date"`
+	Time       string `db:"time" json:"time,omitempty"` // время в формате 15:04, пустое — задача на весь день
+	Title      string `db:"title" json:"title"`
+	Comment    string `db:"comment" json:"comment"`
+	Repeat     string `db:"repeat" json:"repeat"`
+	Anchor     string `db:"anchor" json:"anchor,omitempty"`           // от чего отсчитываются повторения: schedule или completion
+	EndDate    string `db:"end_date" json:"end_date,omitempty"`       // последняя дата серии повторений
+	MaxCount   int    `db:"max_count" json:"max_count,omitempty"`     // число повторений в серии, 0 — без ограничения
+	DoneCount  int    `db:"done_count" json:"done_count,omitempty"`   // сколько повторений уже выполнено, если задан MaxCount
+	SeriesDate string `db:"series_date" json:"series_date,omitempty"` // дата до переноса на рабочий день, если дату переносили
+}
+
+// TrashTask — задача в корзине и время её удаления в формате RFC 3339 (UTC).
+type TrashTask struct {
+	DBTask
+	DeletedAt string `db:"deleted_at" json:"deleted_at"`
+}
+
+// Completion — запись о выполнении задачи: на какую дату и время задача была запланирована,
+// когда её выполнили и с каким комментарием. Записи остаются и после удаления задачи.
+type Completion struct {
+	ID     string `db:"id" json:"id"`
+	TaskID string `db:"task_id" json:"task_id"`
+	Title  string `db:"title" json:"title"`         // заголовок задачи в момент выполнения
+	Date   string `db:"date" json:"date"`           // дата, на которую была запланирована задача
+	Time   string `db:"time" json:"time,omitempty"` // время, на которое была запланирована задача
+	DoneAt string `db:"done_at" json:"done_at"`     // время выполнения в формате RFC 3339 (UTC)
+	Note   string `db:"note" json:"note,omitempty"` // комментарий к выполнению
+}
+
+// Revision — версия задачи после одного изменения: что изменилось, когда и какой стала задача.
+// Исходная версия задачи, записанная перед первым изменением, — без изменений и без времени.
+type Revision struct {
+	ID        string        `json:"id"`
+	TaskID    string        `json:"task_id"`
+	ChangedAt string        `json:"changed_at"` // время изменения в формате RFC 3339 (UTC)
+	Changes   []FieldChange `json:"changes"`
+	Task      DBTask        `json:"task"` // задача после изменения; счётчик выполненных повторений и дата серии не хранятся
+}
+
+// FieldChange — изменение одного поля задачи: имя поля, как в JSON задачи, прежнее и новое значения.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Page задаёт страницу списка задач: не больше Limit задач после задачи, на которую указывает курсор After.
+// Нулевой Limit означает размер страницы по умолчанию, пустой After — первую страницу.
+type Page struct {
+	Limit int
+	After string
+}
+
+// TaskPage — задачи одной страницы списка.
+type TaskPage struct {
+	Tasks      []DBTask
+	NextCursor string // курсор следующей страницы, пустой на последней странице
+	Total      int    // число задач во всём списке
+	// Snippets — фрагменты текста задач с найденными словами, выделенными тегом <mark>, по одному на задачу.
+	// Есть только у результатов полнотекстового поиска.
+	Snippets []string
 }
@@ -0,0 +1,159 @@
+package nextdate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Calendar — производственный календарь: выходные дни недели, праздники и рабочие дни,
+// перенесённые на выходные.
+type Calendar struct {
+	holidays map[time.Time]bool
+	workdays map[time.Time]bool
+}
+
+// calendar используется правилами с рабочими днями. По умолчанию праздников нет,
+// выходные — суббота и воскресенье.
+var calendar = &Calendar{}
+
+// SetCalendar задаёт календарь, по которому считаются рабочие дни. Вызывается при запуске сервера.
+func SetCalendar(c *Calendar) {
+	if c == nil {
+		c = &Calendar{}
+	}
+	calendar = c
+}
+
+// IsWorkday сообщает, рабочий ли день t.
+func (c *Calendar) IsWorkday(t time.Time) bool {
+	t = dateOf(t)
+	if c.workdays[t] {
+		return true
+	}
+	if c.holidays[t] {
+		return false
+	}
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
+
+// LoadCalendar читает календарь из файла. Файл с расширением .ics или начинающийся с
+// BEGIN:VCALENDAR разбирается как iCalendar, остальные — как список дат.
+func LoadCalendar(path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	head, _ := r.Peek(len("BEGIN:VCALENDAR"))
+	if strings.EqualFold(filepath.Ext(path), ".ics") || strings.EqualFold(string(head), "BEGIN:VCALENDAR") {
+		return ParseICS(r)
+	}
+	return ParseDateList(r)
+}
+
+// ParseDateList разбирает список дат, по одной в строке, в формате 20060102, 2006-01-02 или 02.01.2006.
+// Дата с плюсом впереди (+20240427) — рабочий день, перенесённый на выходной. Пустые строки
+// и строки, начинающиеся с #, пропускаются.
+func ParseDateList(r io.Reader) (*Calendar, error) {
+	c := &Calendar{holidays: make(map[time.Time]bool), workdays: make(map[time.Time]bool)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		working := strings.HasPrefix(s, "+")
+		d, err := parseCalendarDate(strings.TrimPrefix(s, "+"))
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", line, err)
+		}
+		if working {
+			c.workdays[d] = true
+		} else {
+			c.holidays[d] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseICS разбирает календарь iCalendar: каждое событие VEVENT считается праздником
+// на все дни от DTSTART до DTEND (не включая DTEND, как принято для событий на целый день).
+func ParseICS(r io.Reader) (*Calendar, error) {
+	c := &Calendar{holidays: make(map[time.Time]bool), workdays: make(map[time.Time]bool)}
+	var start, end time.Time
+	inEvent := false
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		name, value, ok := strings.Cut(s, ":")
+		if !ok {
+			continue
+		}
+		// Параметры свойства (DTSTART;VALUE=DATE) для нас не важны.
+		name, _, _ = strings.Cut(strings.ToUpper(name), ";")
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent, start, end = true, time.Time{}, time.Time{}
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if start.IsZero() {
+				return nil, fmt.Errorf("строка %d: у события нет DTSTART", line)
+			}
+			if end.IsZero() || !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+				c.holidays[d] = true
+			}
+			inEvent = false
+		case inEvent && (name == "DTSTART" || name == "DTEND"):
+			if len(value) < 8 {
+				return nil, fmt.Errorf("строка %d: неверная дата %q", line, value)
+			}
+			d, err := time.Parse("20060102", value[:8])
+			if err != nil {
+				return nil, fmt.Errorf("строка %d: неверная дата %q", line, value)
+			}
+			if name == "DTSTART" {
+				start = d
+			} else {
+				end = d
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseCalendarDate(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102", "2006-01-02", "02.01.2006"} {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неверная дата %q", s)
+}
+
+// shiftToWorkday переносит t на ближайший рабочий день вперёд (step = 1) или назад (step = -1).
+func (c *Calendar) shiftToWorkday(t time.Time, step int) (time.Time, bool) {
+	for i := 0; i < 366; i++ {
+		if c.IsWorkday(t) {
+			return t, true
+		}
+		t = t.AddDate(0, 0, step)
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,454 @@
+package nextdate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Language — язык описания правил повторения.
+type Language string
+
+const (
+	Russian Language = "ru"
+	English Language = "en"
+)
+
+// ParseLanguage возвращает язык по его коду; пустой код означает русский.
+func ParseLanguage(code string) (Language, error) {
+	switch strings.ToLower(code) {
+	case "", "ru":
+		return Russian, nil
+	case "en":
+		return English, nil
+	}
+	return "", fmt.Errorf("язык %q не поддерживается, доступны ru и en", code)
+}
+
+// Describe возвращает описание правила повторения обычной фразой, например
+// "в последний день и 15-го числа января и июня" или "on the last day and the 15th of January and June".
+func Describe(rule Rule, lang Language) string {
+	if lang == English {
+		return describeEnglish(rule)
+	}
+	return describeRussian(rule)
+}
+
+// DescribeRule разбирает правило и возвращает его описание.
+func DescribeRule(repeat string, lang Language) (string, error) {
+	rule, err := ParseRule(repeat)
+	if err != nil {
+		return "", err
+	}
+	return Describe(rule, lang), nil
+}
+
+var (
+	weekdaysEn = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	monthsEn   = [13]string{"", "January", "February", "March", "April", "May", "June", "July",
+		"August", "September", "October", "November", "December"}
+	ordinalsEn = [6]string{"", "first", "second", "third", "fourth", "fifth"}
+
+	// Дни недели во множественном числе дательного падежа: "по понедельникам".
+	weekdaysRuDative = [7]string{"воскресеньям", "понедельникам", "вторникам", "средам", "четвергам", "пятницам", "субботам"}
+	// Дни недели в винительном падеже: "в первый понедельник", "в последнюю пятницу".
+	weekdaysRuAccusative = [7]string{"воскресенье", "понедельник", "вторник", "среду", "четверг", "пятницу", "субботу"}
+	// Род дней недели: 'm' — мужской, 'f' — женский, 'n' — средний.
+	weekdaysRuGender = [7]byte{'n', 'm', 'm', 'f', 'm', 'f', 'f'}
+	monthsRuGenitive = [13]string{"", "января", "февраля", "марта", "апреля", "мая", "июня", "июля",
+		"августа", "сентября", "октября", "ноября", "декабря"}
+	monthsRuPrepositional = [13]string{"", "январе", "феврале", "марте", "апреле", "мае", "июне", "июле",
+		"августе", "сентябре", "октябре", "ноябре", "декабре"}
+	// Порядковые числительные в винительном падеже мужского, женского и среднего рода.
+	ordinalsRu = map[int][3]string{
+		1:  {"первый", "первую", "первое"},
+		2:  {"второй", "вторую", "второе"},
+		3:  {"третий", "третью", "третье"},
+		4:  {"четвёртый", "четвёртую", "четвёртое"},
+		5:  {"пятый", "пятую", "пятое"},
+		-1: {"последний", "последнюю", "последнее"},
+		-2: {"предпоследний", "предпоследнюю", "предпоследнее"},
+	}
+)
+
+func describeEnglish(rule Rule) string {
+	switch r := rule.(type) {
+	case YearlyRule:
+		return "every year"
+	case DailyRule:
+		return everyEnglish(r.Interval, "day")
+	case SubDailyRule:
+		if r.Unit == time.Minute {
+			return everyEnglish(r.Interval, "minute")
+		}
+		return everyEnglish(r.Interval, "hour")
+	case WeeklyRule:
+		return everyEnglish(max(r.Interval, 1), "week") + " on " + joinEnglish(weekdayNamesEn(r.Weekdays))
+	case MonthlyRule:
+		s := "on " + joinEnglish(monthDaysEn(r.Days))
+		if len(r.Months) == 0 {
+			return s + " of every month"
+		}
+		return s + " of " + joinEnglish(monthNames(r.Months, monthsEn))
+	case MonthWeekdayRule:
+		var days []string
+		for _, wd := range r.Weekdays {
+			positions := make([]string, len(r.Positions))
+			for i, n := range r.Positions {
+				positions[i] = ordinalEnglish(n)
+			}
+			days = append(days, "the "+joinEnglish(positions)+" "+weekdaysEn[wd])
+		}
+		s := "on " + joinEnglish(days)
+		if len(r.Months) == 0 {
+			return s + " of every month"
+		}
+		return s + " of " + joinEnglish(monthNames(r.Months, monthsEn))
+	case BusinessDayRule:
+		positions := make([]string, len(r.Positions))
+		for i, n := range r.Positions {
+			positions[i] = ordinalEnglish(n)
+		}
+		s := "on the " + joinEnglish(positions) + " business day"
+		if len(r.Months) == 0 {
+			return s + " of every month"
+		}
+		return s + " of " + joinEnglish(monthNames(r.Months, monthsEn))
+	case ShiftedRule:
+		if r.Backward {
+			return describeEnglish(r.Rule) + ", moved to the previous working day if it falls on a day off"
+		}
+		return describeEnglish(r.Rule) + ", moved to the next working day if it falls on a day off"
+	case *RRule:
+		return r.describeEnglish()
+	}
+	return rule.String()
+}
+
+func describeRussian(rule Rule) string {
+	switch r := rule.(type) {
+	case YearlyRule:
+		return "каждый год"
+	case DailyRule:
+		return everyRussian(r.Interval, unitDay)
+	case SubDailyRule:
+		if r.Unit == time.Minute {
+			return everyRussian(r.Interval, unitMinute)
+		}
+		return everyRussian(r.Interval, unitHour)
+	case WeeklyRule:
+		return everyRussian(max(r.Interval, 1), unitWeek) + " по " + joinRussian(weekdayNamesRu(r.Weekdays))
+	case MonthlyRule:
+		s := monthDaysRu(r.Days)
+		if len(r.Months) == 0 {
+			return s + " каждого месяца"
+		}
+		return s + " " + joinRussian(monthNames(r.Months, monthsRuGenitive))
+	case MonthWeekdayRule:
+		var days []string
+		for _, wd := range r.Weekdays {
+			positions := make([]string, len(r.Positions))
+			for i, n := range r.Positions {
+				positions[i] = ordinalRussian(n, weekdaysRuGender[wd])
+			}
+			days = append(days, joinRussian(positions)+" "+weekdaysRuAccusative[wd])
+		}
+		s := withPreposition(joinRussian(days))
+		if len(r.Months) == 0 {
+			return s + " каждого месяца"
+		}
+		return s + " " + joinRussian(monthNames(r.Months, monthsRuGenitive))
+	case BusinessDayRule:
+		positions := make([]string, len(r.Positions))
+		for i, n := range r.Positions {
+			positions[i] = ordinalRussian(n, 'm')
+		}
+		s := withPreposition(joinRussian(positions)) + " рабочий день"
+		if len(r.Months) == 0 {
+			return s + " каждого месяца"
+		}
+		return s + " " + joinRussian(monthNames(r.Months, monthsRuGenitive))
+	case ShiftedRule:
+		if r.Backward {
+			return describeRussian(r.Rule) + ", с переносом на предыдущий рабочий день, если дата выпадает на выходной"
+		}
+		return describeRussian(r.Rule) + ", с переносом на следующий рабочий день, если дата выпадает на выходной"
+	case *RRule:
+		return r.describeRussian()
+	}
+	return rule.String()
+}
+
+func (r *RRule) describeEnglish() string {
+	units := map[frequency]string{daily: "day", weekly: "week", monthly: "month", yearly: "year"}
+	parts := []string{everyEnglish(r.interval, units[r.freq])}
+
+	var days []string
+	for _, d := range r.byDay {
+		if d.n == 0 {
+			days = append(days, weekdaysEn[d.weekday])
+		} else {
+			days = append(days, "the "+ordinalEnglish(d.n)+" "+weekdaysEn[d.weekday])
+		}
+	}
+	if len(days) > 0 {
+		parts = append(parts, "on "+joinEnglish(days))
+	}
+	if len(r.byMonthDay) > 0 {
+		parts = append(parts, "on "+joinEnglish(monthDaysEn(r.byMonthDay)))
+	}
+	if len(r.byMonth) > 0 {
+		parts = append(parts, "in "+joinEnglish(monthNames(r.byMonth, monthsEn)))
+	}
+	s := strings.Join(parts, " ")
+
+	if len(r.bySetPos) > 0 {
+		pos := make([]string, len(r.bySetPos))
+		for i, p := range r.bySetPos {
+			pos[i] = ordinalEnglish(p)
+		}
+		s += ", only the " + joinEnglish(pos) + " of these days"
+	}
+	if r.count > 0 {
+		s += fmt.Sprintf(", %d %s", r.count, pluralEnglish(r.count, "time"))
+	}
+	if !r.until.IsZero() {
+		s += ", until " + r.until.Format("02.01.2006")
+	}
+	return s
+}
+
+func (r *RRule) describeRussian() string {
+	units := map[frequency]russianUnit{daily: unitDay, weekly: unitWeek, monthly: unitMonth, yearly: unitYear}
+	parts := []string{everyRussian(r.interval, units[r.freq])}
+
+	var plain, ordinal []string
+	for _, d := range r.byDay {
+		if d.n == 0 {
+			plain = append(plain, weekdaysRuDative[d.weekday])
+		} else {
+			ordinal = append(ordinal, ordinalRussian(d.n, weekdaysRuGender[d.weekday])+" "+weekdaysRuAccusative[d.weekday])
+		}
+	}
+	if len(plain) > 0 {
+		parts = append(parts, "по "+joinRussian(plain))
+	}
+	if len(ordinal) > 0 {
+		parts = append(parts, withPreposition(joinRussian(ordinal)))
+	}
+	if len(r.byMonthDay) > 0 {
+		parts = append(parts, monthDaysRu(r.byMonthDay))
+	}
+	if len(r.byMonth) > 0 {
+		parts = append(parts, withPreposition(joinRussian(monthNames(r.byMonth, monthsRuPrepositional))))
+	}
+	s := strings.Join(parts, " ")
+
+	if len(r.bySetPos) > 0 {
+		pos := make([]string, len(r.bySetPos))
+		for i, p := range r.bySetPos {
+			pos[i] = ordinalRussian(p, 'm')
+		}
+		s += ", только " + joinRussian(pos) + " из этих дней"
+	}
+	if r.count > 0 {
+		s += fmt.Sprintf(", %d %s", r.count, pluralRussian(r.count, "раз", "раза", "раз"))
+	}
+	if !r.until.IsZero() {
+		s += ", до " + r.until.Format("02.01.2006")
+	}
+	return s
+}
+
+func everyEnglish(n int, unit string) string {
+	if n == 1 {
+		return "every " + unit
+	}
+	return fmt.Sprintf("every %d %ss", n, unit)
+}
+
+// russianUnit — единица интервала с формами для "каждый день", "каждые 2 дня", "каждые 5 дней".
+type russianUnit struct {
+	every1, everyN string
+	one, few, many string
+}
+
+var (
+	unitDay    = russianUnit{"каждый", "каждые", "день", "дня", "дней"}
+	unitWeek   = russianUnit{"каждую", "каждые", "неделю", "недели", "недель"}
+	unitMonth  = russianUnit{"каждый", "каждые", "месяц", "месяца", "месяцев"}
+	unitYear   = russianUnit{"каждый", "каждые", "год", "года", "лет"}
+	unitHour   = russianUnit{"каждый", "каждые", "час", "часа", "часов"}
+	unitMinute = russianUnit{"каждую", "каждые", "минуту", "минуты", "минут"}
+)
+
+func everyRussian(n int, u russianUnit) string {
+	if n == 1 {
+		return u.every1 + " " + u.one
+	}
+	word := pluralRussian(n, u.one, u.few, u.many)
+	if word == u.one {
+		// "каждый 21 день", но "каждые 22 дня"
+		return fmt.Sprintf("%s %d %s", u.every1, n, word)
+	}
+	return fmt.Sprintf("%s %d %s", u.everyN, n, word)
+}
+
+// pluralRussian выбирает форму слова для числа n: 1 день, 2 дня, 5 дней.
+func pluralRussian(n int, one, few, many string) string {
+	if n < 0 {
+		n = -n
+	}
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return one
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return few
+	}
+	return many
+}
+
+func pluralEnglish(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+func ordinalEnglish(n int) string {
+	switch {
+	case n == -1:
+		return "last"
+	case n == -2:
+		return "second-to-last"
+	case n < 0:
+		return ordinalEnglish(-n) + "-to-last"
+	case n < len(ordinalsEn):
+		return ordinalsEn[n]
+	}
+	return numericOrdinalEnglish(n)
+}
+
+// numericOrdinalEnglish возвращает числительное вида 1st, 2nd, 15th.
+func numericOrdinalEnglish(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// ordinalRussian возвращает порядковое числительное в винительном падеже нужного рода:
+// "второй вторник", "вторую пятницу", "второе воскресенье".
+func ordinalRussian(n int, gender byte) string {
+	forms, ok := ordinalsRu[n]
+	if !ok {
+		forms = [3]string{"-й", "-ю", "-е"}
+		if n < 0 {
+			return strconv.Itoa(-n) + forms[genderIndex(gender)] + " с конца"
+		}
+		return strconv.Itoa(n) + forms[genderIndex(gender)]
+	}
+	return forms[genderIndex(gender)]
+}
+
+func genderIndex(gender byte) int {
+	switch gender {
+	case 'f':
+		return 1
+	case 'n':
+		return 2
+	}
+	return 0
+}
+
+// withPreposition добавляет предлог "в" или "во" ("во вторник", "в среду").
+func withPreposition(phrase string) string {
+	if strings.HasPrefix(phrase, "втор") || strings.HasPrefix(phrase, "вс") {
+		return "во " + phrase
+	}
+	return "в " + phrase
+}
+
+func weekdayNamesEn(days []time.Weekday) []string {
+	names := make([]string, len(days))
+	for i, wd := range days {
+		names[i] = weekdaysEn[wd]
+	}
+	return names
+}
+
+func weekdayNamesRu(days []time.Weekday) []string {
+	names := make([]string, len(days))
+	for i, wd := range days {
+		names[i] = weekdaysRuDative[wd]
+	}
+	return names
+}
+
+func monthNames(months []time.Month, names [13]string) []string {
+	res := make([]string, len(months))
+	for i, m := range months {
+		res[i] = names[m]
+	}
+	return res
+}
+
+func monthDaysEn(days []int) []string {
+	res := make([]string, len(days))
+	for i, d := range days {
+		if d < 0 {
+			res[i] = "the " + ordinalEnglish(d) + " day"
+		} else {
+			res[i] = "the " + numericOrdinalEnglish(d)
+		}
+	}
+	return res
+}
+
+// monthDaysRu описывает дни месяца: "в последний день и 15-го числа".
+func monthDaysRu(days []int) string {
+	var numbers, fromEnd []string
+	for _, d := range days {
+		if d > 0 {
+			numbers = append(numbers, strconv.Itoa(d)+"-го")
+		} else {
+			fromEnd = append(fromEnd, ordinalRussian(d, 'm'))
+		}
+	}
+	var parts []string
+	if len(fromEnd) > 0 {
+		parts = append(parts, "в "+joinRussian(fromEnd)+" день")
+	}
+	if len(numbers) > 0 {
+		parts = append(parts, joinRussian(numbers)+" числа")
+	}
+	if len(parts) == 2 && days[0] > 0 {
+		parts[0], parts[1] = parts[1], parts[0]
+	}
+	return strings.Join(parts, " и ")
+}
+
+func joinEnglish(items []string) string {
+	return joinWith(items, " and ")
+}
+
+func joinRussian(items []string) string {
+	return joinWith(items, " и ")
+}
+
+// joinWith перечисляет элементы через запятую, последний — через union: "a, b and c".
+func joinWith(items []string, union string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + union + items[len(items)-1]
+}
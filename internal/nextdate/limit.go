@@ -0,0 +1,113 @@
+package nextdate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxCount — наибольшее число повторений, которое можно задать задаче.
+const MaxCount = 10000
+
+// Limit — условия окончания серии повторений задачи.
+type Limit struct {
+	EndDate  string // последняя дата серии в формате 20060102, пустая — без ограничения
+	MaxCount int    // число повторений в серии, считая дату задачи; 0 — без ограничения
+}
+
+// Check проверяет условия окончания серии.
+func (l Limit) Check() error {
+	if l.EndDate != "" {
+		if _, err := time.Parse("20060102", l.EndDate); err != nil {
+			return errors.New("дата окончания представлена в формате, отличном от 20060102")
+		}
+	}
+	if l.MaxCount < 0 || l.MaxCount > MaxCount {
+		return fmt.Errorf("число повторений должно быть от 1 до %d, 0 — без ограничения", MaxCount)
+	}
+	return nil
+}
+
+// Ended сообщает, что дата next уже не входит в серию, потому что она позже даты окончания.
+func (l Limit) Ended(next string) bool {
+	return l.EndDate != "" && next > l.EndDate
+}
+
+// apply добавляет к правилу условия окончания серии. Правило без условий не меняется.
+func (l Limit) apply(rule Rule) Rule {
+	if l == (Limit{}) {
+		return rule
+	}
+	r := LimitedRule{Rule: rule, Count: l.MaxCount}
+	if l.EndDate != "" {
+		until, _ := time.Parse("20060102", l.EndDate)
+		// У правил h и min последний день серии тоже входит в неё целиком.
+		r.Until = until.Add(24*time.Hour - time.Nanosecond)
+	}
+	return r
+}
+
+// LimitedRule — правило, серия которого заканчивается после даты Until или после Count повторений.
+// Первым повторением считается сама дата задачи.
+type LimitedRule struct {
+	Rule
+	Until time.Time // нулевая — без ограничения
+	Count int       // 0 — без ограничения
+}
+
+func (r LimitedRule) Next(start, after time.Time) (time.Time, error) {
+	var found time.Time
+	err := walk(r, start, after, func(d time.Time) bool {
+		found = d
+		return false
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if found.IsZero() {
+		return time.Time{}, ErrNoOccurrence
+	}
+	return found, nil
+}
+
+// Passed возвращает, сколько повторений серии прошло, когда задачу с датой date и временем clock перенесли
+// на дату next и время nextClock: сама дата задачи и все даты правила repeat до next. Время учитывается
+// только у правил h и min. Счёт останавливается на max, чтобы не перебирать частые повторения без нужды.
+func Passed(date, clock, next, nextClock, repeat string, max int) (int, error) {
+	rule, err := ParseRule(repeat)
+	if err != nil {
+		return 0, err
+	}
+	start, err := time.Parse("20060102", date)
+	if err != nil {
+		return 0, err
+	}
+	end, err := time.Parse("20060102", next)
+	if err != nil {
+		return 0, err
+	}
+	if isSubDaily(rule) {
+		offset, err := ParseClock(clock)
+		if err != nil {
+			return 0, err
+		}
+		nextOffset, err := ParseClock(nextClock)
+		if err != nil {
+			return 0, err
+		}
+		start, end = start.Add(offset), end.Add(nextOffset)
+	}
+	if !start.Before(end) {
+		return 0, nil
+	}
+
+	passed := 1
+	err = walk(rule, start, start, func(d time.Time) bool {
+		if passed >= max || !d.Before(end) {
+			return false
+		}
+		passed++
+		return true
+	})
+	return passed, err
+}
@@ -1,20 +1,26 @@
 package nextdate
 
 import (
-	"errors"
 	"fmt"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
 
+// ClockLayout — формат времени задачи.
+const ClockLayout = "15:04"
+
 // NextDate returns the next date of the task
 // с параметрами:
 // now — время от которого ищется ближайшая дата;
 // date — исходное время в формате 20060102, от которого начинается отсчёт повторений;
-// repeat — правило повторения в описанном выше формате.
+// repeat — правило повторения, разбираемое ParseRule.
 func NextDate(now time.Time, date string, repeat string) (string, error) {
+	return NextDateLimited(now, date, repeat, Limit{})
+}
+
+// NextDateLimited работает как NextDate, но учитывает условия окончания серии limit.
+// Когда повторений не осталось, возвращает ErrNoOccurrence.
+func NextDateLimited(now time.Time, date string, repeat string, limit Limit) (string, error) {
 	if repeat == "" {
 		return "", nil
 	}
@@ -23,250 +29,222 @@ func NextDate(now time.Time, date string, repeat string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if err := limit.Check(); err != nil {
+		return "", err
+	}
 
-	switch repeat[0] {
-	case 'y':
-		return addYear(t, now)
-	case 'd':
-		return addDays(t, now, repeat)
-	case 'w':
-		// err := errors.New("не реализовано")
-		// return date, err
-		return AddWeeks(t, now, repeat)
-	case 'm':
-		// err := errors.New("не реализовано")
-		// return date, err
-		return AddMonths(t, now, repeat)
+	rule, err := ParseRule(repeat)
+	if err != nil {
+		return "", err
 	}
-	return "", nil
+	return nextFromRule(t, now, limit.apply(rule))
 }
 
-func addYear(t time.Time, now time.Time) (string, error) {
-	for {
-		t = t.AddDate(1, 0, 0)
-		if t.After(now) {
-			break
-		}
-	}
-	return t.Format("20060102"), nil
+// Advance возвращает следующую дату задачи и правило повторения, которое нужно сохранить вместе с ней.
+// Правило меняется только у RRULE с COUNT: счётчик уменьшается на число пройденных повторений,
+// иначе после переноса даты задачи серия начиналась бы заново.
+func Advance(now time.Time, date string, repeat string) (string, string, error) {
+	next, _, repeat, err := advance(now, date, repeat)
+	return next, repeat, err
 }
 
-func addDays(t time.Time, now time.Time, repeat string) (string, error) {
-	rep := strings.Split(repeat, " ")
-	if len(rep) != 2 {
-		err := errors.New("не указан интервал в днях")
-		return "", err
+// advance работает как Advance и дополнительно возвращает дату серии — дату основного правила
+// до переноса на рабочий день (см. ShiftedRule) или пустую строку, если перенос дату не изменил.
+func advance(now time.Time, date string, repeat string) (string, string, string, error) {
+	next, err := NextDate(now, date, repeat)
+	if err != nil || repeat == "" {
+		return next, "", repeat, err
 	}
-	daysNumber, err := strconv.Atoi(rep[1])
+
+	rule, err := ParseRule(repeat)
 	if err != nil {
-		return "", err
-	}
-	if daysNumber > 400 || daysNumber < 1 {
-		err := errors.New("превышен максимально допустимый интервал")
-		return "", err
-	} else {
-		for {
-			t = t.AddDate(0, 0, daysNumber)
-			if t.After(now) {
-				break
-			}
+		return "", "", "", err
+	}
+	start, _ := time.Parse("20060102", date)
+	series, _ := time.Parse("20060102", next)
+	if shifted, ok := rule.(ShiftedRule); ok {
+		rule = shifted.Rule
+		if series, _, err = shifted.next(start, dateOf(now)); err != nil {
+			return "", "", "", err
 		}
-		return t.Format("20060102"), nil
 	}
-}
-
-func AddWeeks(t time.Time, now time.Time, repeat string) (string, error) {
-	var weekDays []int
-	if len(repeat) < 3 {
-		return "", errors.New("не указан интервал в днях недели")
+	seriesDate := ""
+	if series.Format("20060102") != next {
+		seriesDate = series.Format("20060102")
 	}
 
-	weekDaysStr := strings.Split(repeat[2:], ",")
-	if len(weekDaysStr) == 0 {
-		return "", errors.New("не указан интервал в днях недели")
+	rr, ok := rule.(*RRule)
+	if !ok || rr.count == 0 {
+		return next, seriesDate, repeat, nil
 	}
+	// Пройденные повторения считаются по датам серии: дата до переноса уже входит в серию.
+	passed := rr.countBefore(start, series)
 
-	for _, day := range weekDaysStr {
-		dayNumber, err := strconv.Atoi(day)
-		if err != nil {
-			return "", err
-		}
-		if dayNumber < 1 || dayNumber > 7 {
-			return "", fmt.Errorf("недопустимое значение %d дня недели", dayNumber)
-		}
-		weekDays = append(weekDays, dayNumber)
-	}
+	return next, seriesDate, withCount(repeat, rr.count-passed), nil
+}
 
-	for i, day := range weekDays {
-		if day == 7 {
-			weekDays[i] = 0
-		}
+// ParseClock разбирает время задачи в формате 15:04 и возвращает его как смещение от полуночи.
+// Пустая строка означает задачу на весь день и даёт нулевое смещение.
+func ParseClock(clock string) (time.Duration, error) {
+	if clock == "" {
+		return 0, nil
 	}
-
-	sort.Ints(weekDays)
-	var nextWeekDay int
-	for _, wd := range weekDays {
-		if wd >= int(t.Weekday()) { // Check if wd is greater than or equal to the current weekday
-			nextWeekDay = wd
-			break
-		}
+	t, err := time.Parse(ClockLayout, clock)
+	if err != nil {
+		return 0, fmt.Errorf("время представлено в формате, отличном от 15:04")
 	}
-	if nextWeekDay == 0 { // If no future weekday was found in this week, take the first day of the next week
-		nextWeekDay = weekDays[0]
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// NextDateTime работает как NextDate, но повторение наступает не в полночь, а во время clock:
+// если сегодняшнее повторение ещё не наступило, возвращается сегодняшняя дата.
+// Возвращает дату и время следующего повторения. Время меняется только у правил h и min,
+// у остальных оно переносится на следующую дату без изменений.
+func NextDateTime(now time.Time, date string, clock string, repeat string) (string, string, error) {
+	if rule, err := ParseRule(repeat); err == nil && isSubDaily(rule) {
+		return nextSlot(now, date, clock, rule)
 	}
-	for {
-		t = t.AddDate(0, 0, 1)
-		if t.After(now) && int(t.Weekday()) == nextWeekDay {
-			return t.Format("20060102"), nil
-		}
+	after, err := beforeClock(now, clock)
+	if err != nil {
+		return "", "", err
 	}
+	next, err := NextDate(after, date, repeat)
+	return next, clock, err
 }
 
-func AddMonths(t time.Time, now time.Time, repeat string) (string, error) {
-	var listOfDays time.Time
-	var err error
-	if len(repeat) < 3 {
-		return "", errors.New("не указан интервал в месяцах")
+// AdvanceAt работает как Advance, но с учётом времени задачи, как NextDateTime.
+// Возвращает дату, время и правило, которые нужно сохранить в задаче.
+func AdvanceAt(now time.Time, date string, clock string, repeat string) (string, string, string, error) {
+	if rule, err := ParseRule(repeat); err == nil && isSubDaily(rule) {
+		next, clock, err := nextSlot(now, date, clock, rule)
+		return next, clock, repeat, err
+	}
+	after, err := beforeClock(now, clock)
+	if err != nil {
+		return "", "", "", err
 	}
+	next, repeat, err := Advance(after, date, repeat)
+	return next, clock, repeat, err
+}
 
-	repSlice := strings.Split(repeat, " ")
+// Anchor — от чего отсчитываются повторения выполненной задачи.
+type Anchor string
 
-	if len(repSlice) == 2 {
-		listOfDays, err = getNextDate(now, t.Format("20060102"), repeat)
-		if err != nil {
-			return "", err
-		}
-	} else if len(repSlice) == 3 {
-		listOfDays = getNextMonthDate(now, t.Format("20060102"), repeat)
-	} else {
-		return "", errors.New("неверный формат повторения")
-	}
+const (
+	AnchorSchedule   Anchor = "schedule"   // от запланированной даты задачи
+	AnchorCompletion Anchor = "completion" // от дня выполнения
+)
 
-	return listOfDays.Format("20060102"), nil
+// ParseAnchor возвращает режим отсчёта повторений по его названию; пустое название означает schedule.
+func ParseAnchor(name string) (Anchor, error) {
+	switch strings.ToLower(name) {
+	case "", "schedule":
+		return AnchorSchedule, nil
+	case "completion":
+		return AnchorCompletion, nil
+	}
+	return "", fmt.Errorf("режим повторения %q не поддерживается, доступны schedule и completion", name)
 }
 
-func getNextMonthDate(now time.Time, target string, rule string) time.Time {
-	// Parse the rule
-	ruleParts := strings.Split(rule, " ")
-	daysPart := strings.Split(ruleParts[1], ",")
-	monthsPart := strings.Split(ruleParts[2], ",")
-
-	// Convert days and months to integers
-	days := make([]int, len(daysPart))
-	for i, day := range daysPart {
-		days[i], _ = strconv.Atoi(day)
+// Complete возвращает дату, дату серии, время и правило задачи после её выполнения в момент now.
+// Задача с правилом h или min переносится на первый слот после now, остальные — как в Advance,
+// на первую дату после сегодняшней, даже если сегодняшнее время задачи ещё не наступило.
+// При anchor = AnchorCompletion повторения отсчитываются не от даты задачи, а от дня выполнения
+// (у правил h и min — от момента выполнения): "d 7" переносит задачу на неделю после выполнения.
+// series — дата серии, которую вернул прошлый вызов Complete: если дата задачи была перенесена
+// на рабочий день, повторения отсчитываются от даты до переноса. Возвращаемая дата серии пустая,
+// если перенос дату не изменил.
+func Complete(now time.Time, date string, series string, clock string, repeat string, anchor Anchor) (string, string, string, string, error) {
+	rule, err := ParseRule(repeat)
+	subDaily := err == nil && isSubDaily(rule)
+	switch {
+	case anchor == AnchorCompletion:
+		date = now.Format("20060102")
+		if subDaily {
+			clock = now.Format(ClockLayout)
+		}
+	case series != "":
+		date = series
 	}
-	months := make([]int, len(monthsPart))
-	for i, month := range monthsPart {
-		months[i], _ = strconv.Atoi(month)
+	if subDaily {
+		next, clock, err := nextSlot(now, date, clock, rule)
+		return next, "", clock, repeat, err
 	}
+	next, series, repeat, err := advance(now, date, repeat)
+	return next, series, clock, repeat, err
+}
 
-	// Initialize targetTime and nearestDate
-	targetTime, _ := time.Parse("20060102", target)
-	var nearestDate time.Time
+// nextSlot возвращает дату и время первого повторения правила h или min после now.
+func nextSlot(now time.Time, date string, clock string, rule Rule) (string, string, error) {
+	start, err := time.Parse("20060102", date)
+	if err != nil {
+		return "", "", err
+	}
+	offset, err := ParseClock(clock)
+	if err != nil {
+		return "", "", err
+	}
+	next, err := rule.Next(start.Add(offset), wallTime(now))
+	if err != nil {
+		return "", "", err
+	}
+	return next.Format("20060102"), next.Format(ClockLayout), nil
+}
 
-	// Loop until we find a date after today
-	for {
-		for _, day := range days {
-			for _, month := range months {
-				var date time.Time
-				if day < 0 {
-					// If day is negative, calculate the date from the end of the current month
-					endOfMonth := time.Date(targetTime.Year(), time.Month(month+1), 0, 0, 0, 0, 0, time.UTC)
-					date = endOfMonth.AddDate(0, 0, day+1)
-				} else {
-					date = time.Date(targetTime.Year(), time.Month(month), day, 0, 0, 0, 0, time.UTC)
-				}
-				// If the date is before now, add a year
-				if date.Before(now) {
-					date = date.AddDate(1, 0, 0)
-				}
-				// If this is the first date we've found, or it's earlier than the current nearest date, update nearestDate
-				if (nearestDate.IsZero() || date.Before(nearestDate)) && date.After(now) {
-					nearestDate = date
-				}
-			}
-		}
-		// If nearestDate is not zero, it means we have found a date after today, so break the loop
-		if !nearestDate.IsZero() {
-			break
-		}
-		// If no date after today is found in this year, increment the year
-		targetTime = targetTime.AddDate(1, 0, 0)
+// beforeClock сдвигает now назад на время clock. Дата, которая больше даты результата,
+// вместе со временем clock оказывается позже now, поэтому результат можно передавать в NextDate.
+// Сдвиг считается по показаниям часов, чтобы переход на летнее время не смещал дату.
+func beforeClock(now time.Time, clock string) (time.Time, error) {
+	offset, err := ParseClock(clock)
+	if err != nil {
+		return time.Time{}, err
 	}
+	return wallTime(now).Add(-offset), nil
+}
 
-	return nearestDate
+// AddWeeks возвращает следующую дату для правила вида "w 1,2,3".
+func AddWeeks(t time.Time, now time.Time, repeat string) (string, error) {
+	return nextFrom(t, now, repeat)
 }
 
-func getNextDate(now time.Time, target string, rule string) (time.Time, error) {
-	// Parse target date
-	targetTime, _ := time.Parse("20060102", target)
+// AddMonths возвращает следующую дату для правила вида "m 1,15" или "m 1,15 1,6".
+func AddMonths(t time.Time, now time.Time, repeat string) (string, error) {
+	return nextFrom(t, now, repeat)
+}
 
-	// Split rule into "m" and the rest
-	ruleParts := strings.SplitN(rule, " ", 2)
-	if len(ruleParts) != 2 {
-		return time.Time{}, fmt.Errorf("invalid rule format")
+func nextFrom(t time.Time, now time.Time, repeat string) (string, error) {
+	rule, err := ParseRule(repeat)
+	if err != nil {
+		return "", err
 	}
+	return nextFromRule(t, now, rule)
+}
 
-	// Check if the rest of the rule contains a comma
-	var monthDays []int
-	if strings.Contains(ruleParts[1], ",") {
-		daysParts := strings.Split(ruleParts[1], ",")
-		monthDays = make([]int, len(daysParts))
-		for i, part := range daysParts {
-			day, err := strconv.Atoi(strings.TrimSpace(part))
-			if err != nil {
-				return time.Time{}, fmt.Errorf("invalid day in rule: %v", err)
-			}
-			if day < -2 || day > 31 {
-				return time.Time{}, fmt.Errorf("не правильно указан формат повтора")
-			}
-			monthDays[i] = day
-		}
-	} else {
-		day, err := strconv.Atoi(strings.TrimSpace(ruleParts[1]))
-		if err != nil {
-			return time.Time{}, fmt.Errorf("invalid day in rule: %v", err)
-		}
-		if day < -2 || day > 31 {
-			return time.Time{}, fmt.Errorf("не правильно указан формат повтора")
-		}
-		monthDays = []int{day}
+func nextFromRule(t time.Time, now time.Time, rule Rule) (string, error) {
+	date, err := rule.Next(t, searchAfter(now, rule))
+	if err != nil {
+		return "", err
 	}
-	// Find the nearest date
-	var nearestDate time.Time
-	for {
-		for _, day := range monthDays {
-			var date time.Time
-			// Define endOfMonth here
-			endOfMonth := time.Date(targetTime.Year(), targetTime.Month()+1, 0, 0, 0, 0, 0, time.UTC)
-			if day < 0 {
-				// If day is negative, calculate the date from the end of the current month
-				date = endOfMonth.AddDate(0, 0, day+1)
-			} else {
-				if day > endOfMonth.Day() {
-					targetTime = targetTime.AddDate(0, 1, 0)
-					endOfMonth = time.Date(targetTime.Year(), targetTime.Month()+1, 0, 0, 0, 0, 0, time.UTC)
-				}
-				date = time.Date(targetTime.Year(), targetTime.Month(), day, 0, 0, 0, 0, time.UTC)
-			}
-			// Now endOfMonth is accessible here
-			if date.Before(now) || date.After(endOfMonth) {
-				date = date.AddDate(0, 1, 0)
-			}
-			// If this is the first date we've found, or it's earlier than the current nearest date, update nearestDate
-			if (nearestDate.IsZero() || date.Before(nearestDate)) && date.After(now) {
-				nearestDate = date
-				// break
-			}
-		}
-		// If nearestDate is not zero, it means we have found a date after today, so break the loop
-		if !nearestDate.IsZero() {
-			break
-		}
-		// If no date after today is found in this month, increment the month
-		targetTime = targetTime.AddDate(0, 1, 0)
+	return date.Format("20060102"), nil
+}
+
+// searchAfter возвращает момент, после которого ищется следующая дата правила rule, если сейчас now.
+func searchAfter(now time.Time, rule Rule) time.Time {
+	after := dateOf(now)
+	if isSubDaily(rule) {
+		// Без времени задачи дата повторения правила h или min — первый день после сегодняшнего.
+		after = after.Add(24*time.Hour - time.Nanosecond)
 	}
+	return after
+}
+
+// dateOf возвращает календарную дату момента t (в его часовом поясе) как полночь UTC,
+// чтобы её можно было сравнивать с датами задач.
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
 
-	return nearestDate, nil
+// wallTime возвращает показания часов момента t (в его часовом поясе) как время в UTC.
+func wallTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
 }
@@ -1,6 +1,9 @@
 package nextdate
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,6 +21,8 @@ func TestNextDate(t *testing.T) {
 		{"ooops", "y", ""},
 		{"16890220", "y", `20240220`},
 		{"20250701", "y", `20260701`},
+		{"20240120", "h 4", `20240127`},
+		{"20240120", "min 45", `20240127`},
 		{"20240101", "y", `20250101`},
 		{"20231231", "y", `20241231`},
 		{"20240229", "y", `20250301`},
@@ -30,6 +35,21 @@ func TestNextDate(t *testing.T) {
 		{"20231225", "d 12", `20240130`},
 		{"20240228", "d 1", "20240229"},
 		{"20231225", "d 12", `20240130`},
+		{"20240101", "w 1,4 2", `20240129`},
+		{"20240125", "w 1,4 2", `20240205`},
+		{"20240101", "w 7 3", `20240128`},
+		{"20240126", "w 5 1", `20240202`},
+		{"20240101", "w 1,4 0", ""},
+		{"20240101", "w 1,4 x", ""},
+		{"20240101", "mw 2 2", `20240213`},
+		{"20240101", "mw 5 -1", `20240223`},
+		{"20240101", "mw 1 1 1,4,7,10", `20240401`},
+		{"20240101", "mw 4 5", `20240229`},
+		{"20240101", "mw 1 5 2", `20440229`},
+		{"20240126", "mw 1,3 1", `20240205`},
+		{"20240101", "mw 2", ""},
+		{"20240101", "mw 2 6", ""},
+		{"20240101", "mw 8 1", ""},
 	}
 
 	for _, tt := range tests {
@@ -41,3 +61,679 @@ func TestNextDate(t *testing.T) {
 		}
 	}
 }
+
+func TestNextDateRRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		date    string
+		repeat  string
+		want    string
+		wantErr bool
+	}{
+		{"every 3 days", "20240120", "RRULE:FREQ=DAILY;INTERVAL=3", "20240129", false},
+		{"every 3 weeks on Mon,Fri", "20240101", "RRULE:FREQ=WEEKLY;INTERVAL=3;BYDAY=MO,FR", "20240212", false},
+		{"every 2nd Tuesday", "20240101", "RRULE:FREQ=MONTHLY;BYDAY=2TU", "20240213", false},
+		{"last Friday", "20240101", "RRULE:FREQ=MONTHLY;BYDAY=-1FR", "20240223", false},
+		{"last weekday of month", "20240101", "RRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", "20240131", false},
+		{"yearly by month and day", "20200101", "RRULE:FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=8", "20240308", false},
+		{"yearly on Feb 29", "20200229", "RRULE:FREQ=YEARLY", "20240229", false},
+		{"month day from the end", "20240101", "RRULE:FREQ=MONTHLY;BYMONTHDAY=-2", "20240130", false},
+		{"until not reached", "20240105", "RRULE:FREQ=WEEKLY;UNTIL=20240210", "20240202", false},
+		{"until passed", "20240105", "RRULE:FREQ=WEEKLY;UNTIL=20240201", "", true},
+		{"count exhausted", "20240120", "RRULE:FREQ=DAILY;COUNT=3", "", true},
+		{"count left", "20240120", "RRULE:FREQ=DAILY;COUNT=10", "20240127", false},
+		{"unsupported freq", "20240101", "RRULE:FREQ=HOURLY", "", true},
+		{"no freq", "20240101", "RRULE:BYDAY=MO", "", true},
+		{"impossible date", "20240101", "RRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", "", true},
+		{"count with until", "20240101", "RRULE:FREQ=DAILY;COUNT=2;UNTIL=20240201", "", true},
+	}
+
+	now, _ := time.Parse("20060102", "20240126")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextDate(now, tt.date, tt.repeat)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextDate(%v, %v) returned error: %v, wantErr: %v", tt.date, tt.repeat, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NextDate(%v, %v) = %v, want %v", tt.date, tt.repeat, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvanceRRuleCount(t *testing.T) {
+	now, _ := time.Parse("20060102", "20240126")
+	next, repeat, err := Advance(now, "20240120", "RRULE:FREQ=DAILY;COUNT=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != "20240127" || repeat != "RRULE:FREQ=DAILY;COUNT=3" {
+		t.Errorf("Advance() = %v, %v; want 20240127, RRULE:FREQ=DAILY;COUNT=3", next, repeat)
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	now, _ := time.Parse("20060102", "20240126")
+	tests := []struct {
+		name   string
+		date   string
+		repeat string
+		n      int
+		want   []string
+	}{
+		{"days", "20240120", "d 7", 3, []string{"20240127", "20240203", "20240210"}},
+		{"weekdays", "20240125", "w 1,3", 3, []string{"20240129", "20240131", "20240205"}},
+		{"fortnightly", "20240101", "w 1,4 2", 4, []string{"20240129", "20240201", "20240212", "20240215"}},
+		{"month days", "20240101", "m 1,15", 3, []string{"20240201", "20240215", "20240301"}},
+		{"last day of month", "20240101", "m -1", 3, []string{"20240131", "20240229", "20240331"}},
+		{"day missing in some months", "20240101", "m 30 2,3", 2, []string{"20240330", "20250330"}},
+		{"years", "20200229", "y", 2, []string{"20240301", "20250301"}},
+		{"series ends", "20240120", "RRULE:FREQ=DAILY;COUNT=9", 5, []string{"20240127", "20240128"}},
+		{"no repeat", "20240120", "", 3, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Occurrences(now, tt.date, tt.repeat, tt.n, Limit{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Occurrences(%v, %v, %d) = %v, want %v", tt.date, tt.repeat, tt.n, got, tt.want)
+			}
+		})
+	}
+
+	got, err := OccurrencesUntil(now, "20240120", "d 10", "20240220", Limit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "20240130,20240209,20240219"; strings.Join(got, ",") != want {
+		t.Errorf("OccurrencesUntil() = %v, want %v", got, want)
+	}
+
+	if _, err := Occurrences(now, "20240120", "d 1", MaxOccurrences+1, Limit{}); err == nil {
+		t.Error("Occurrences() with too many dates returned no error")
+	}
+}
+
+func TestOccurrencesLongSeries(t *testing.T) {
+	// Даты длинной серии с COUNT перебираются за один проход, а не заново от даты задачи для каждой.
+	now, _ := time.Parse("20060102", "20240126")
+	begin := time.Now()
+	got, err := Occurrences(now, "20240120", "RRULE:FREQ=DAILY;COUNT=10000", MaxOccurrences, Limit{MaxCount: MaxCount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Errorf("Occurrences() took %v", elapsed)
+	}
+	last := now.AddDate(0, 0, MaxOccurrences).Format("20060102")
+	if len(got) != MaxOccurrences || got[0] != "20240127" || got[len(got)-1] != last {
+		t.Errorf("Occurrences() = %d dates from %v to %v, want %d dates from 20240127 to %v",
+			len(got), got[0], got[len(got)-1], MaxOccurrences, last)
+	}
+
+	// Число повторений считается по датам после переноса, начиная с даты задачи.
+	got, err = Occurrences(now, "20240120", "d 1 b+", MaxOccurrences, Limit{MaxCount: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "20240129,20240130,20240131,20240201,20240202,20240205"; strings.Join(got, ",") != want {
+		t.Errorf("Occurrences() = %v, want %v", got, want)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		repeat    string
+		want      Rule
+		wantToken string
+	}{
+		{"y", YearlyRule{}, ""},
+		{"d 7", DailyRule{Interval: 7}, ""},
+		{"w 1,7", WeeklyRule{Weekdays: []time.Weekday{time.Monday, time.Sunday}}, ""},
+		{"m -1,15 1,6", MonthlyRule{Days: []int{-1, 15}, Months: []time.Month{time.January, time.June}}, ""},
+		{"y 2", nil, "2"},
+		{"d 0", nil, "0"},
+		{"d 7 8", nil, "8"},
+		{"w 1,8", nil, "8"},
+		{"w 1,4 2", WeeklyRule{Weekdays: []time.Weekday{time.Monday, time.Thursday}, Interval: 2}, ""},
+		{"w 1,4 53", nil, "53"},
+		{"m 1,x 13", nil, "x"},
+		{"m 1 1,13", nil, "13"},
+		{"m 31 2", nil, "31"},
+		{"m 30,31 2,3", MonthlyRule{Days: []int{30, 31}, Months: []time.Month{time.February, time.March}}, ""},
+		{"mw 2 -1 1,6", MonthWeekdayRule{Weekdays: []time.Weekday{time.Tuesday}, Positions: []int{-1}, Months: []time.Month{time.January, time.June}}, ""},
+		{"mw 2 0", nil, "0"},
+		{"m 15 b+", ShiftedRule{Rule: MonthlyRule{Days: []int{15}}}, ""},
+		{"mb -1 1,6", BusinessDayRule{Positions: []int{-1}, Months: []time.Month{time.January, time.June}}, ""},
+		{"mb 24", nil, "24"},
+		{"b+", nil, "b+"},
+		{"h 4", SubDailyRule{Interval: 4, Unit: time.Hour}, ""},
+		{"min 30", SubDailyRule{Interval: 30, Unit: time.Minute}, ""},
+		{"h 25", nil, "25"},
+		{"min", nil, ""},
+		{"h 4 b+", nil, "b+"},
+		{"k 34", nil, "k"},
+		{"RRULE:FREQ=DAILY;BYMONTH=x", nil, "x"},
+		{"RRULE:FREQ=DAILY;FOO=1", nil, "FOO=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repeat, func(t *testing.T) {
+			got, err := ParseRule(tt.repeat)
+			if tt.want == nil {
+				var ruleErr *RuleError
+				if !errors.As(err, &ruleErr) {
+					t.Fatalf("ParseRule(%q) error = %v, want *RuleError", tt.repeat, err)
+				}
+				if ruleErr.Token != tt.wantToken || ruleErr.Rule != tt.repeat {
+					t.Errorf("ParseRule(%q) error token = %q, want %q", tt.repeat, ruleErr.Token, tt.wantToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRule(%q) returned error: %v", tt.repeat, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRule(%q) = %#v, want %#v", tt.repeat, got, tt.want)
+			}
+			if got.String() != tt.repeat {
+				t.Errorf("ParseRule(%q).String() = %q", tt.repeat, got.String())
+			}
+		})
+	}
+}
+
+func TestDescribeRule(t *testing.T) {
+	tests := []struct {
+		repeat string
+		ru     string
+		en     string
+	}{
+		{"y", "каждый год", "every year"},
+		{"d 1", "каждый день", "every day"},
+		{"d 21", "каждый 21 день", "every 21 days"},
+		{"d 5", "каждые 5 дней", "every 5 days"},
+		{"w 1,4", "каждую неделю по понедельникам и четвергам", "every week on Monday and Thursday"},
+		{"w 1,4 2", "каждые 2 недели по понедельникам и четвергам", "every 2 weeks on Monday and Thursday"},
+		{"m -1,15 1,6", "в последний день и 15-го числа января и июня", "on the last day and the 15th of January and June"},
+		{"m 1,-2", "1-го числа и в предпоследний день каждого месяца", "on the 1st and the second-to-last day of every month"},
+		{"h 1", "каждый час", "every hour"},
+		{"h 4", "каждые 4 часа", "every 4 hours"},
+		{"min 1", "каждую минуту", "every minute"},
+		{"min 30", "каждые 30 минут", "every 30 minutes"},
+		{"mb 1", "в первый рабочий день каждого месяца", "on the first business day of every month"},
+		{"mb -1 12", "в последний рабочий день декабря", "on the last business day of December"},
+		{"m 15 b-", "15-го числа каждого месяца, с переносом на предыдущий рабочий день, если дата выпадает на выходной",
+			"on the 15th of every month, moved to the previous working day if it falls on a day off"},
+		{"mw 2 2", "во второй вторник каждого месяца", "on the second Tuesday of every month"},
+		{"mw 5 -1 1,6", "в последнюю пятницу января и июня", "on the last Friday of January and June"},
+		{"mw 1 1,3", "в первый и третий понедельник каждого месяца", "on the first and third Monday of every month"},
+		{"RRULE:FREQ=MONTHLY;BYDAY=2TU", "каждый месяц во второй вторник", "every month on the second Tuesday"},
+		{"RRULE:FREQ=MONTHLY;BYDAY=-1FR", "каждый месяц в последнюю пятницу", "every month on the last Friday"},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=3;BYDAY=MO,FR", "каждые 3 недели по понедельникам и пятницам", "every 3 weeks on Monday and Friday"},
+		{"RRULE:FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=8;COUNT=3", "каждый год 8-го числа в марте, 3 раза", "every year on the 8th in March, 3 times"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repeat, func(t *testing.T) {
+			for lang, want := range map[Language]string{Russian: tt.ru, English: tt.en} {
+				got, err := DescribeRule(tt.repeat, lang)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("DescribeRule(%q, %s) = %q, want %q", tt.repeat, lang, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := DescribeRule("k 34", Russian); err == nil {
+		t.Error("DescribeRule() for invalid rule returned no error")
+	}
+}
+
+func TestWorkdays(t *testing.T) {
+	cal, err := ParseDateList(strings.NewReader(`# праздники
+20240101
+2024-01-02
+03.01.2024
+20240104
+20240105
+20240108
+20240308
++20240427
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCalendar(cal)
+	defer SetCalendar(nil)
+
+	tests := []struct {
+		now    string
+		date   string
+		repeat string
+		want   string
+	}{
+		{"20240126", "20240101", "m 8 3 b+", "20240311"},
+		{"20240126", "20240101", "m 8 3 b-", "20240307"},
+		{"20240126", "20240101", "m 10 2 b+", "20240212"},
+		{"20240127", "20240101", "m 27 b+", "20240129"},
+		{"20240126", "20240101", "m 28 4 b-", "20240427"},
+		{"20240420", "20240101", "w 6", "20240427"},
+		{"20231220", "20231201", "mb 1", "20240109"},
+		{"20240126", "20240101", "mb -1", "20240131"},
+		{"20240126", "20240101", "mb 2 3", "20240304"},
+		{"20240126", "20240101", "RRULE:FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=8 b+", "20240311"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repeat, func(t *testing.T) {
+			now, _ := time.Parse("20060102", tt.now)
+			got, err := NextDate(now, tt.date, tt.repeat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("NextDate(%v, %v, %v) = %v, want %v", tt.now, tt.date, tt.repeat, got, tt.want)
+			}
+		})
+	}
+
+	if cal.IsWorkday(time.Date(2024, 4, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Sunday 20240428 should not be a workday")
+	}
+	if !cal.IsWorkday(time.Date(2024, 4, 27, 0, 0, 0, 0, time.UTC)) {
+		t.Error("transferred Saturday 20240427 should be a workday")
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	cal, err := ParseICS(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20240501
+SUMMARY:Праздник весны и труда
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20240609
+DTEND;VALUE=DATE:20240613
+SUMMARY:Каникулы
+END:VEVENT
+END:VCALENDAR
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		date    string
+		workday bool
+	}{
+		{"20240430", true},
+		{"20240501", false},
+		{"20240610", false},
+		{"20240612", false},
+		{"20240613", true},
+	} {
+		d, _ := time.Parse("20060102", tt.date)
+		if got := cal.IsWorkday(d); got != tt.workday {
+			t.Errorf("IsWorkday(%v) = %v, want %v", tt.date, got, tt.workday)
+		}
+	}
+}
+
+func TestNextDateTime(t *testing.T) {
+	now := time.Date(2024, 1, 26, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		date   string
+		clock  string
+		repeat string
+		want   string
+	}{
+		{"20240120", "09:00", "d 1", "20240127"},
+		{"20240120", "18:30", "d 1", "20240126"},
+		{"20240126", "18:30", "d 1", "20240127"},
+		{"20240126", "10:00", "d 1", "20240127"},
+		{"20240120", "", "d 1", "20240127"},
+		{"20240101", "12:00", "w 5", "20240126"},
+		{"20240101", "08:00", "w 5", "20240202"},
+		{"20240126", "08:00", "h 4", "20240126 12:00"},
+		{"20240120", "09:00", "h 4", "20240126 13:00"},
+		{"20240126", "09:45", "min 30", "20240126 10:15"},
+		{"20240125", "22:00", "h 24", "20240126"},
+		{"20240126", "", "h 5", "20240126 15:00"},
+		{"20240126", "23:50", "min 20", "20240127 00:10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date+" "+tt.clock+" "+tt.repeat, func(t *testing.T) {
+			date, clock, err := NextDateTime(now, tt.date, tt.clock, tt.repeat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := date
+			if clock != tt.clock {
+				got += " " + clock
+			}
+			if got != tt.want {
+				t.Errorf("NextDateTime(%v, %v, %v) = %v, want %v", tt.date, tt.clock, tt.repeat, got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := NextDateTime(now, "20240120", "9:00pm", "d 1"); err == nil {
+		t.Error("expected error for invalid time")
+	}
+}
+
+func TestNextDateTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		now   time.Time
+		clock string
+		want  string
+	}{
+		// По UTC ещё 30 марта, но у пользователя уже 31-е.
+		{time.Date(2024, 3, 31, 0, 30, 0, 0, berlin), "", "20240401"},
+		// В 02:00 часы переводятся на 03:00: до 09:00 остаётся меньше, чем по UTC.
+		{time.Date(2024, 3, 31, 8, 30, 0, 0, berlin), "09:00", "20240331"},
+		{time.Date(2024, 3, 31, 9, 30, 0, 0, berlin), "09:00", "20240401"},
+		// 27 октября длится 25 часов.
+		{time.Date(2024, 10, 27, 23, 30, 0, 0, berlin), "", "20241028"},
+		{time.Date(2024, 10, 27, 23, 30, 0, 0, berlin), "23:45", "20241027"},
+	}
+	for _, tt := range tests {
+		got, _, err := NextDateTime(tt.now, "20240101", tt.clock, "d 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("NextDateTime(%v, %q) = %v, want %v", tt.now, tt.clock, got, tt.want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	now := time.Date(2024, 1, 26, 10, 7, 0, 0, time.UTC)
+	tests := []struct {
+		date, clock, repeat string
+		anchor              Anchor
+		wantDate, wantClock string
+	}{
+		{"20240126", "08:00", "h 4", AnchorSchedule, "20240126", "12:00"},
+		{"20240125", "23:30", "min 15", AnchorSchedule, "20240126", "10:15"},
+		// Задачу со временем, выполненную заранее, переносим на завтра, а не оставляем на сегодня.
+		{"20240126", "18:00", "d 1", AnchorSchedule, "20240127", "18:00"},
+		{"20240120", "", "d 7", AnchorSchedule, "20240127", ""},
+		{"20240120", "", "d 7", AnchorCompletion, "20240202", ""},
+		{"20240126", "08:00", "h 4", AnchorCompletion, "20240126", "14:07"},
+		{"20240101", "", "w 1 2", AnchorSchedule, "20240129", ""},
+		{"20240101", "", "w 1 2", AnchorCompletion, "20240205", ""},
+		{"20240201", "09:00", "d 3", AnchorCompletion, "20240129", "09:00"},
+	}
+	for _, tt := range tests {
+		date, series, clock, repeat, err := Complete(now, tt.date, "", tt.clock, tt.repeat, tt.anchor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if date != tt.wantDate || series != "" || clock != tt.wantClock || repeat != tt.repeat {
+			t.Errorf("Complete(%v, %v, %v, %v) = %v %v %v, want %v %v %v", tt.date, tt.clock, tt.repeat, tt.anchor,
+				date, clock, repeat, tt.wantDate, tt.wantClock, tt.repeat)
+		}
+	}
+}
+
+// TestCompleteShifted проверяет, что перенос на рабочий день не сдвигает серию: задачу несколько раз
+// подряд выполняют в день, на который она запланирована, и каждый раз передают дату серии из прошлого вызова.
+func TestCompleteShifted(t *testing.T) {
+	tests := []struct {
+		date, repeat string
+		want         []string // дата и дата серии после каждого выполнения
+	}{
+		{"20220101", "y b+", []string{"20230102 20230101", "20240101 ", "20250101 ", "20260101 "}},
+		{"20230901", "RRULE:FREQ=MONTHLY b+", []string{"20231002 20231001", "20231101 ", "20231201 "}},
+		{"20230901", "RRULE:FREQ=MONTHLY;COUNT=4 b+", []string{"20231002 20231001", "20231101 ", "20231201 "}},
+		{"20230901", "m 1 b-", []string{"20230929 20231001", "20231101 ", "20231201 "}},
+	}
+	for _, tt := range tests {
+		date, series, repeat := tt.date, "", tt.repeat
+		for i, want := range tt.want {
+			now, _ := time.Parse("20060102", date)
+			next, nextSeries, _, nextRepeat, err := Complete(now, date, series, "", repeat, AnchorSchedule)
+			if err != nil {
+				t.Fatalf("%s, шаг %d: %v", tt.repeat, i+1, err)
+			}
+			if got := next + " " + nextSeries; got != want {
+				t.Errorf("%s, шаг %d: Complete() = %q, want %q", tt.repeat, i+1, got, want)
+			}
+			date, series, repeat = next, nextSeries, nextRepeat
+		}
+		if tt.repeat == "RRULE:FREQ=MONTHLY;COUNT=4 b+" && repeat != "RRULE:FREQ=MONTHLY;COUNT=1 b+" {
+			t.Errorf("%s: правило после трёх выполнений %q, want COUNT=1", tt.repeat, repeat)
+		}
+	}
+}
+
+func TestParseAnchor(t *testing.T) {
+	for name, want := range map[string]Anchor{"": AnchorSchedule, "schedule": AnchorSchedule, "Completion": AnchorCompletion} {
+		got, err := ParseAnchor(name)
+		if err != nil || got != want {
+			t.Errorf("ParseAnchor(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseAnchor("done"); err == nil {
+		t.Error("ParseAnchor(\"done\") expected error")
+	}
+}
+
+func TestNextDateLimited(t *testing.T) {
+	now, _ := time.Parse("20060102", "20240126")
+	tests := []struct {
+		date    string
+		repeat  string
+		limit   Limit
+		want    string
+		wantErr error
+	}{
+		{"20240120", "d 3", Limit{}, "20240129", nil},
+		{"20240120", "d 3", Limit{EndDate: "20240129"}, "20240129", nil},
+		{"20240120", "d 3", Limit{EndDate: "20240128"}, "", ErrNoOccurrence},
+		{"20240120", "d 3", Limit{MaxCount: 4}, "20240129", nil},
+		{"20240120", "d 3", Limit{MaxCount: 3}, "", ErrNoOccurrence},
+		{"20240120", "d 3", Limit{EndDate: "20240201", MaxCount: 10}, "20240129", nil},
+		{"20240101", "w 1,5", Limit{MaxCount: 8}, "", ErrNoOccurrence},
+		{"20240101", "w 1,5", Limit{MaxCount: 9}, "20240129", nil},
+		{"20240120", "h 4", Limit{EndDate: "20240127"}, "20240127", nil},
+		{"20240120", "h 4", Limit{EndDate: "20240126"}, "", ErrNoOccurrence},
+	}
+	for _, tt := range tests {
+		got, err := NextDateLimited(now, tt.date, tt.repeat, tt.limit)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("NextDateLimited(%v, %v, %+v) = %q, %v, want %q, %v", tt.date, tt.repeat, tt.limit, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	dates, err := Occurrences(now, "20240120", "d 3", 10, Limit{MaxCount: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20240129", "20240201", "20240204"}; !reflect.DeepEqual(dates, want) {
+		t.Errorf("Occurrences() = %v, want %v", dates, want)
+	}
+
+	for _, limit := range []Limit{{EndDate: "2024-01-30"}, {MaxCount: -1}, {MaxCount: MaxCount + 1}} {
+		if _, err := NextDateLimited(now, "20240120", "d 3", limit); err == nil {
+			t.Errorf("NextDateLimited() with %+v returned no error", limit)
+		}
+	}
+}
+
+func TestPassed(t *testing.T) {
+	tests := []struct {
+		date, clock, next, nextClock, repeat string
+		max                                  int
+		want                                 int
+	}{
+		{"20240120", "", "20240129", "", "d 3", 10, 3},
+		{"20240120", "", "20240129", "", "d 3", 2, 2},
+		{"20240129", "", "20240129", "", "d 3", 10, 0},
+		{"20240101", "", "20240129", "", "w 1,5", 20, 8},
+		{"20240126", "09:00", "20240126", "15:00", "h 2", 10, 3},
+		{"20240125", "22:00", "20240126", "02:00", "h 2", 10, 2},
+		{"15000101", "", "20240127", "", "d 1", 5, 5},
+	}
+	for _, tt := range tests {
+		got, err := Passed(tt.date, tt.clock, tt.next, tt.nextClock, tt.repeat, tt.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Passed(%v %v, %v %v, %v, %d) = %d, want %d", tt.date, tt.clock, tt.next, tt.nextClock, tt.repeat, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestNextDateFarPast(t *testing.T) {
+	now, _ := time.Parse("20060102", "20240126")
+	tests := []struct {
+		date   string
+		repeat string
+		want   string
+	}{
+		{"15000101", "d 1", "20240127"},
+		{"15000101", "d 7", "20240129"},
+		{"15000101", "y", "20250101"},
+		{"15000101", "w 1,5 2", "20240205"},
+		{"15000101", "m -1", "20240131"},
+		{"15000101", "mw 1 1", "20240205"},
+		{"15000101", "RRULE:FREQ=DAILY;INTERVAL=3", "20240129"},
+		{"15000101", "RRULE:FREQ=WEEKLY;BYDAY=MO", "20240129"},
+	}
+	for _, tt := range tests {
+		got, err := NextDate(now, tt.date, tt.repeat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("NextDate(%v, %v) = %v, want %v", tt.date, tt.repeat, got, tt.want)
+		}
+	}
+}
+
+// TestNextDateTerminates проверяет, что правила, которые не могут совпасть ни с одной датой,
+// отклоняются при разборе или возвращают ErrNoOccurrence, а не зацикливаются.
+func TestNextDateTerminates(t *testing.T) {
+	now, _ := time.Parse("20060102", "20240126")
+	for _, repeat := range []string{
+		"m 31 2",
+		"m 30,31 2",
+		"m 31 4,6,9,11",
+		"RRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30",
+		"RRULE:FREQ=MONTHLY;BYMONTHDAY=31;BYMONTH=4",
+		"RRULE:FREQ=YEARLY;BYMONTH=2;BYDAY=5MO;BYMONTHDAY=1",
+	} {
+		_, err := NextDate(now, "20240101", repeat)
+		var ruleErr *RuleError
+		if !errors.As(err, &ruleErr) && !errors.Is(err, ErrNoOccurrence) {
+			t.Errorf("NextDate(%q) error = %v, want RuleError or ErrNoOccurrence", repeat, err)
+		}
+	}
+}
+
+func BenchmarkNextDate(b *testing.B) {
+	now, _ := time.Parse("20060102", "20240126")
+	rules := []string{"d 1", "d 7", "y", "w 1,5", "w 3 4", "m 1,-1", "m 29 2", "mw 2 2", "h 4",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "RRULE:FREQ=MONTHLY;BYDAY=-1FR"}
+	// Время вычисления не должно зависеть от того, насколько дата задачи далека от now.
+	for _, date := range []string{"20231201", "19000101", "15000101"} {
+		for _, repeat := range rules {
+			b.Run(date+"/"+repeat, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := NextDate(now, date, repeat); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2024, 1, 26, 15, 0, 0, 0, time.UTC) // пятница
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"20240501", "20240501"},
+		{"2024-05-01", "20240501"},
+		{"01.05.2024", "20240501"},
+		{"today", "20240126"},
+		{"Tomorrow", "20240127"},
+		{"yesterday", "20240125"},
+		{"day after tomorrow", "20240128"},
+		{"сегодня", "20240126"},
+		{"Завтра", "20240127"},
+		{"послезавтра", "20240128"},
+		{"+3d", "20240129"},
+		{"-1d", "20240125"},
+		{"+2w", "20240209"},
+		{"+1m", "20240226"},
+		{"+1y", "20250126"},
+		{"+7975y", "99990126"},
+		{"+3д", "20240129"},
+		{"in 3 days", "20240129"},
+		{"in a week", "20240202"},
+		{"через неделю", "20240202"},
+		{"через 2 недели", "20240209"},
+		{"через 5 дней", "20240131"},
+		{"через месяц", "20240226"},
+		{"через год", "20250126"},
+		{"next friday", "20240202"},
+		{"monday", "20240129"},
+		{"saturday", "20240127"},
+		{"в пятницу", "20240202"},
+		{"во вторник", "20240130"},
+		{"в следующую среду", "20240131"},
+		{"  в   субботу ", "20240127"},
+		{"воскресенье", "20240128"},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.in, now)
+		if err != nil {
+			t.Errorf("ParseDate(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got.Format("20060102") != tt.want {
+			t.Errorf("ParseDate(%q) = %v, want %v", tt.in, got.Format("20060102"), tt.want)
+		}
+	}
+
+	// Последний день месяца остаётся последним, а не переходит в следующий месяц.
+	endOfJanuary := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	if got, _ := ParseDate("+1m", endOfJanuary); got.Format("20060102") != "20240229" {
+		t.Errorf("ParseDate(+1m) from 20240131 = %v, want 20240229", got.Format("20060102"))
+	}
+
+	for _, in := range []string{"", "20240132", "2024/05/01", "someday", "через", "+3q", "next", "in many days",
+		"через 99999999999999999999 дней", "+99999999999999999999d", "+99999999y", "+7976y", "-2024y"} {
+		if _, err := ParseDate(in, now); !errors.Is(err, ErrDateFormat) {
+			t.Errorf("ParseDate(%q) error = %v, want ErrDateFormat", in, err)
+		}
+	}
+
+	// Дата задачи не принимает формат 02.01.2006, который остаётся только для поиска.
+	if got, err := ParseTaskDate("2024-05-01", now); err != nil || got.Format("20060102") != "20240501" {
+		t.Errorf("ParseTaskDate(2024-05-01) = %v, %v; want 20240501", got.Format("20060102"), err)
+	}
+	for _, in := range []string{"01.02.2024", "32.01.2024", "someday", "+99999999y"} {
+		if _, err := ParseTaskDate(in, now); !errors.Is(err, ErrTaskDateFormat) {
+			t.Errorf("ParseTaskDate(%q) error = %v, want ErrTaskDateFormat", in, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package nextdate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxOccurrences — наибольшее число дат, которое можно получить за один запрос.
+const MaxOccurrences = 1000
+
+// Occurrences возвращает до n ближайших дат повторения после now в формате 20060102.
+// Если серия заканчивается раньше (COUNT или UNTIL в правиле или условия limit), возвращается столько дат, сколько осталось.
+func Occurrences(now time.Time, date string, repeat string, n int, limit Limit) ([]string, error) {
+	if n < 1 || n > MaxOccurrences {
+		return nil, fmt.Errorf("количество дат должно быть от 1 до %d", MaxOccurrences)
+	}
+	return occurrences(now, date, repeat, limit, func(dates []string, _ string) bool {
+		return len(dates) < n
+	})
+}
+
+// OccurrencesUntil возвращает все даты повторения после now и не позже until (включительно).
+func OccurrencesUntil(now time.Time, date string, repeat string, until string, limit Limit) ([]string, error) {
+	if _, err := time.Parse("20060102", until); err != nil {
+		return nil, errors.New("дата окончания представлена в формате, отличном от 20060102")
+	}
+	dates, err := occurrences(now, date, repeat, limit, func(dates []string, next string) bool {
+		return next <= until && len(dates) <= MaxOccurrences
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(dates) > MaxOccurrences {
+		return nil, fmt.Errorf("в интервале больше %d дат, сузьте его", MaxOccurrences)
+	}
+	return dates, nil
+}
+
+// occurrences перебирает даты правила по порядку, пока more разрешает добавить очередную дату.
+// Правила h и min дают не больше одной даты в день.
+func occurrences(now time.Time, date string, repeat string, limit Limit, more func(dates []string, next string) bool) ([]string, error) {
+	dates := []string{}
+	if repeat == "" {
+		return dates, nil
+	}
+	start, err := time.Parse("20060102", date)
+	if err != nil {
+		return nil, err
+	}
+	if err := limit.Check(); err != nil {
+		return nil, err
+	}
+	rule, err := ParseRule(repeat)
+	if err != nil {
+		return nil, err
+	}
+
+	var last time.Time
+	err = walk(limit.apply(rule), start, searchAfter(now, rule), func(d time.Time) bool {
+		day := dateOf(d)
+		if day.Equal(last) {
+			return true
+		}
+		last = day
+		next := day.Format("20060102")
+		if !more(dates, next) {
+			return false
+		}
+		dates = append(dates, next)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dates, nil
+}
+
+// walk вызывает yield для дат правила rule строго после start и строго после after по возрастанию,
+// пока yield возвращает true или пока у правила не закончатся даты. В отличие от вызовов Next
+// подряд, RRULE с COUNT и ограничения LimitedRule не пересчитываются каждый раз от start.
+func walk(rule Rule, start, after time.Time, yield func(time.Time) bool) error {
+	if after.Before(start) {
+		after = start
+	}
+	switch r := rule.(type) {
+	case *RRule:
+		r.each(start, after, func(d time.Time) bool {
+			return !d.After(after) || yield(d)
+		})
+		return nil
+	case ShiftedRule:
+		step := 1
+		if r.Backward {
+			step = -1
+		}
+		// Как и в ShiftedRule.Next, даты основного правила перебираются начиная чуть раньше after.
+		from := after.AddDate(0, 0, -maxShift)
+		if from.Before(start) {
+			from = start
+		}
+		last := after
+		return walk(r.Rule, start, from, func(raw time.Time) bool {
+			shifted, ok := calendar.shiftToWorkday(raw, step)
+			if !ok {
+				return false
+			}
+			// Несколько дат основного правила могут перенестись на один и тот же день.
+			if !shifted.After(last) {
+				return true
+			}
+			last = shifted
+			return yield(shifted)
+		})
+	case LimitedRule:
+		// Без Count даты до after можно не считать.
+		from, n := after, 0
+		if r.Count > 0 {
+			from, n = start, 1
+		}
+		return walk(r.Rule, start, from, func(d time.Time) bool {
+			n++
+			if r.Count > 0 && n > r.Count || !r.Until.IsZero() && d.After(r.Until) {
+				return false
+			}
+			return !d.After(after) || yield(d)
+		})
+	}
+
+	for d := after; ; {
+		next, err := rule.Next(start, d)
+		if errors.Is(err, ErrNoOccurrence) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !yield(next) {
+			return nil
+		}
+		d = next
+	}
+}
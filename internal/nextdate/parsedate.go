@@ -0,0 +1,156 @@
+package nextdate
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDateFormat возвращается ParseDate, когда дату не удалось распознать.
+var ErrDateFormat = errors.New("дата не распознана: ожидается 20060102, 2006-01-02, 02.01.2006 или выражение вроде today, +3d, next friday, завтра, через неделю")
+
+// ErrTaskDateFormat возвращается ParseTaskDate, когда дату задачи не удалось распознать.
+var ErrTaskDateFormat = errors.New("дата задачи не распознана: ожидается 20060102, 2006-01-02 или выражение вроде today, +3d, next friday, завтра, через неделю")
+
+// dateLayouts — форматы, в которых дату можно указать явно.
+var dateLayouts = []string{"20060102", "2006-01-02", "02.01.2006"}
+
+// taskDateLayouts — форматы, в которых явно указывается дата задачи: 02.01.2006 принимает только поиск.
+var taskDateLayouts = []string{"20060102", "2006-01-02"}
+
+// relativeDays — слова, обозначающие дату относительно сегодняшней.
+var relativeDays = map[string]int{
+	"today": 0, "tomorrow": 1, "yesterday": -1, "day after tomorrow": 2, "day before yesterday": -2,
+	"сегодня": 0, "завтра": 1, "вчера": -1, "послезавтра": 2, "позавчера": -2,
+}
+
+// dateUnits — единицы сдвига даты: d — дни, w — недели, m — месяцы, y — годы.
+var dateUnits = map[string]byte{
+	"d": 'd', "day": 'd', "days": 'd', "д": 'd', "день": 'd', "дня": 'd', "дней": 'd',
+	"w": 'w', "week": 'w', "weeks": 'w', "н": 'w', "неделю": 'w', "недели": 'w', "недель": 'w',
+	"m": 'm', "month": 'm', "months": 'm', "м": 'm', "месяц": 'm', "месяца": 'm', "месяцев": 'm',
+	"y": 'y', "year": 'y', "years": 'y', "г": 'y', "год": 'y', "года": 'y', "лет": 'y',
+}
+
+// weekdayNames — названия дней недели в формах, в которых их пишут в выражениях вроде "в пятницу".
+var weekdayNames = map[string]time.Weekday{
+	"monday": time.Monday, "mon": time.Monday, "понедельник": time.Monday, "пн": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "вторник": time.Tuesday, "вт": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday, "среда": time.Wednesday, "среду": time.Wednesday, "ср": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "четверг": time.Thursday, "чт": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday, "пятница": time.Friday, "пятницу": time.Friday, "пт": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday, "суббота": time.Saturday, "субботу": time.Saturday, "сб": time.Saturday,
+	"sunday": time.Sunday, "sun": time.Sunday, "воскресенье": time.Sunday, "вс": time.Sunday,
+}
+
+// weekdayPrefixes — слова перед названием дня недели, которые не меняют дату.
+var weekdayPrefixes = []string{"next ", "on ", "в ", "во ", "следующий ", "следующую ", "следующее ", "следующая "}
+
+// maxOffset — наибольший сдвиг в любых единицах: дальше 9999 лет дата всё равно не записывается в формате 20060102.
+const maxOffset = 9999 * 366
+
+var (
+	// offsetPattern — сдвиг вида "+3d", "-1w", "+2 м".
+	offsetPattern = regexp.MustCompile(`^([+-])(\d+)\s*(\pL+)$`)
+	// inPattern — сдвиг вида "in 3 days", "in a week", "через 2 недели", "через месяц".
+	inPattern = regexp.MustCompile(`^(?:in|через)\s+(?:(\d+|a|an|one)\s+)?(\pL+)$`)
+)
+
+// ParseDate распознаёт дату, записанную явно (20060102, 2006-01-02, 02.01.2006) или выражением
+// относительно сегодняшнего дня now: today, tomorrow, +3d, in 2 weeks, next friday, завтра,
+// через неделю, в пятницу. День недели означает ближайший такой день после сегодняшнего.
+// Возвращает дату как полночь UTC.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	return parseDate(s, now, dateLayouts)
+}
+
+// ParseTaskDate распознаёт дату задачи так же, как ParseDate, но не принимает формат 02.01.2006.
+func ParseTaskDate(s string, now time.Time) (time.Time, error) {
+	t, err := parseDate(s, now, taskDateLayouts)
+	if errors.Is(err, ErrDateFormat) {
+		return time.Time{}, ErrTaskDateFormat
+	}
+	return t, err
+}
+
+// parseDate распознаёт дату, записанную в одном из форматов layouts или выражением.
+func parseDate(s string, now time.Time, layouts []string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	s = strings.ReplaceAll(s, "ё", "е")
+	today := dateOf(now)
+
+	if days, ok := relativeDays[s]; ok {
+		return today.AddDate(0, 0, days), nil
+	}
+
+	if m := offsetPattern.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[2])
+		if unit, ok := dateUnits[m[3]]; ok {
+			if err != nil || n > maxOffset {
+				return time.Time{}, ErrDateFormat
+			}
+			if m[1] == "-" {
+				n = -n
+			}
+			return checkYear(shiftDate(today, n, unit))
+		}
+	}
+
+	if m := inPattern.FindStringSubmatch(s); m != nil {
+		n := 1
+		if m[1] != "" && m[1] != "a" && m[1] != "an" && m[1] != "one" {
+			var err error
+			if n, err = strconv.Atoi(m[1]); err != nil || n > maxOffset {
+				return time.Time{}, ErrDateFormat
+			}
+		}
+		if unit, ok := dateUnits[m[2]]; ok {
+			return checkYear(shiftDate(today, n, unit))
+		}
+	}
+
+	for _, prefix := range weekdayPrefixes {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	if wd, ok := weekdayNames[s]; ok {
+		days := (int(wd)-int(today.Weekday())+6)%7 + 1
+		return today.AddDate(0, 0, days), nil
+	}
+
+	return time.Time{}, ErrDateFormat
+}
+
+// checkYear возвращает ErrDateFormat для дат, год которых не записать четырьмя цифрами.
+func checkYear(t time.Time) (time.Time, error) {
+	if t.Year() < 1 || t.Year() > 9999 {
+		return time.Time{}, ErrDateFormat
+	}
+	return t, nil
+}
+
+// shiftDate сдвигает дату на n единиц unit. При сдвиге на месяцы и годы день, которого нет
+// в получившемся месяце, заменяется последним днём месяца: 31 января + 1 месяц — 29 февраля.
+func shiftDate(t time.Time, n int, unit byte) time.Time {
+	switch unit {
+	case 'w':
+		return t.AddDate(0, 0, 7*n)
+	case 'm', 'y':
+		months := n
+		if unit == 'y' {
+			months = 12 * n
+		}
+		first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+		day := min(t.Day(), daysIn(first.Year(), first.Month()))
+		return first.AddDate(0, 0, day-1)
+	}
+	return t.AddDate(0, 0, n)
+}
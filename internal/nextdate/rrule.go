@@ -0,0 +1,518 @@
+package nextdate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rrulePrefix — префикс правила повторения в формате RFC 5545.
+const rrulePrefix = "RRULE:"
+
+type frequency int
+
+const (
+	daily frequency = iota
+	weekly
+	monthly
+	yearly
+)
+
+var frequencies = map[string]frequency{
+	"DAILY":   daily,
+	"WEEKLY":  weekly,
+	"MONTHLY": monthly,
+	"YEARLY":  yearly,
+}
+
+// maxEmptyPeriods — сколько периодов подряд без единой даты перебирается, прежде чем
+// правило признаётся пустым. Григорианский календарь повторяется каждые 400 лет,
+// поэтому правило, не давшее дат за 400 лет, не даст их никогда.
+var maxEmptyPeriods = map[frequency]int{
+	daily:   146097,
+	weekly:  20871,
+	monthly: 4800,
+	yearly:  400,
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// byDay — элемент BYDAY: день недели с необязательным порядковым номером (2TU, -1FR).
+type byDay struct {
+	n       int
+	weekday time.Weekday
+}
+
+// RRule — правило повторения в формате RFC 5545.
+type RRule struct {
+	text       string
+	freq       frequency
+	interval   int
+	byDay      []byDay
+	byMonthDay []int
+	byMonth    []time.Month
+	bySetPos   []int
+	count      int
+	until      time.Time
+	wkst       time.Weekday
+}
+
+// parseRRule разбирает строку вида RRULE:FREQ=WEEKLY;INTERVAL=3;BYDAY=MO,FR.
+func parseRRule(repeat string) (*RRule, error) {
+	body := strings.TrimPrefix(repeat, rrulePrefix)
+	if body == "" {
+		return nil, ruleError("", "пустое правило RRULE")
+	}
+
+	r := &RRule{text: repeat, interval: 1, wkst: time.Monday}
+	seen := make(map[string]bool)
+	freqSet := false
+	for _, part := range strings.Split(body, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, ruleError(part, "ожидается параметр вида KEY=VALUE")
+		}
+		key = strings.ToUpper(key)
+		if seen[key] {
+			return nil, ruleError(part, "параметр указан дважды")
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			f, ok := frequencies[strings.ToUpper(value)]
+			if !ok {
+				return nil, ruleError(part, "поддерживаются частоты DAILY, WEEKLY, MONTHLY и YEARLY")
+			}
+			r.freq, freqSet = f, true
+		case "INTERVAL":
+			r.interval, err = parseRRuleInt(part, value, 1, 10000)
+		case "COUNT":
+			r.count, err = parseRRuleInt(part, value, 1, 10000)
+		case "UNTIL":
+			r.until, err = parseUntil(part, value)
+		case "BYMONTH":
+			r.byMonth, err = parseByMonth(value)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseIntList(value, 31)
+		case "BYSETPOS":
+			r.bySetPos, err = parseIntList(value, 366)
+		case "BYDAY":
+			r.byDay, err = parseByDay(value)
+		case "WKST":
+			wd, ok := weekdayCodes[strings.ToUpper(value)]
+			if !ok {
+				return nil, ruleError(part, "ожидается день недели MO, TU, WE, TH, FR, SA или SU")
+			}
+			r.wkst = wd
+		default:
+			return nil, ruleError(part, "неподдерживаемый параметр")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !freqSet {
+		return nil, ruleError("", "не указан параметр FREQ")
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return nil, ruleError("", "COUNT и UNTIL нельзя указывать вместе")
+	}
+	if len(r.bySetPos) > 0 && len(r.byDay) == 0 && len(r.byMonthDay) == 0 && len(r.byMonth) == 0 {
+		return nil, ruleError("BYSETPOS", "используется только вместе с другим параметром BY*")
+	}
+	if r.freq == weekly && len(r.byMonthDay) > 0 {
+		return nil, ruleError("BYMONTHDAY", "нельзя использовать с FREQ=WEEKLY")
+	}
+	for _, d := range r.byDay {
+		if d.n == 0 {
+			continue
+		}
+		if r.freq != monthly && r.freq != yearly {
+			return nil, ruleError("BYDAY", "порядковый номер дня недели допустим только для MONTHLY и YEARLY")
+		}
+		if r.freq == monthly && (d.n < -5 || d.n > 5) {
+			return nil, ruleError("BYDAY", fmt.Sprintf("в месяце не бывает %d-го дня недели", d.n))
+		}
+	}
+	if !r.possible() {
+		return nil, ruleError("BYMONTHDAY", "таких дней нет ни в одном из месяцев BYMONTH")
+	}
+
+	return r, nil
+}
+
+func parseRRuleInt(part, value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, ruleError(part, fmt.Sprintf("ожидается число от %d до %d", min, max))
+	}
+	return n, nil
+}
+
+// parseIntList разбирает список ненулевых чисел от -max до max.
+func parseIntList(value string, max int) ([]int, error) {
+	var list []int
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "+"))
+		if err != nil || n == 0 || n < -max || n > max {
+			return nil, ruleError(s, fmt.Sprintf("ожидается ненулевое число от -%d до %d", max, max))
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func parseByMonth(value string) ([]time.Month, error) {
+	var months []time.Month
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 12 {
+			return nil, ruleError(s, "месяц должен быть числом от 1 до 12")
+		}
+		months = append(months, time.Month(n))
+	}
+	return months, nil
+}
+
+func parseByDay(value string) ([]byDay, error) {
+	var days []byDay
+	for _, s := range strings.Split(value, ",") {
+		code := strings.ToUpper(s)
+		if len(code) < 2 {
+			return nil, ruleError(s, "ожидается день недели вида MO, 2TU или -1FR")
+		}
+		wd, ok := weekdayCodes[code[len(code)-2:]]
+		if !ok {
+			return nil, ruleError(s, "ожидается день недели вида MO, 2TU или -1FR")
+		}
+		d := byDay{weekday: wd}
+		if prefix := code[:len(code)-2]; prefix != "" {
+			n, err := strconv.Atoi(strings.TrimPrefix(prefix, "+"))
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, ruleError(s, "порядковый номер должен быть ненулевым числом от -53 до 53")
+			}
+			d.n = n
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// parseUntil принимает UNTIL в виде даты (20240131) или даты со временем (20240131T235959Z).
+func parseUntil(part, value string) (time.Time, error) {
+	if len(value) > 8 && value[8] == 'T' {
+		value = value[:8]
+	}
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, ruleError(part, "дата должна быть в формате 20060102")
+	}
+	return t, nil
+}
+
+// possible отсекает очевидно невозможные сочетания BYMONTH и BYMONTHDAY, например 30 февраля.
+func (r *RRule) possible() bool {
+	if len(r.byMonth) == 0 || len(r.byMonthDay) == 0 {
+		return true
+	}
+	for _, m := range r.byMonth {
+		longest := daysIn(2024, m) // 2024 — високосный год, у февраля 29 дней
+		for _, d := range r.byMonthDay {
+			if d <= longest && -d <= longest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String возвращает правило в том виде, в каком его записал пользователь.
+func (r *RRule) String() string {
+	return r.text
+}
+
+// Next возвращает первую дату правила строго после after, считая start первым повторением (DTSTART).
+func (r *RRule) Next(start, after time.Time) (time.Time, error) {
+	if after.Before(start) {
+		after = start
+	}
+	var found time.Time
+	r.each(start, after, func(d time.Time) bool {
+		if d.After(after) {
+			found = d
+			return false
+		}
+		return true
+	})
+	if found.IsZero() {
+		return time.Time{}, ErrNoOccurrence
+	}
+	return found, nil
+}
+
+// withCount возвращает исходную строку правила, в которой COUNT заменён на count.
+// Остальные части правила не трогаются, чтобы сохранить запись пользователя.
+func withCount(repeat string, count int) string {
+	base, mod := splitModifier(repeat)
+	parts := strings.Split(strings.TrimPrefix(base, rrulePrefix), ";")
+	for i, part := range parts {
+		if key, _, _ := strings.Cut(part, "="); strings.EqualFold(key, "COUNT") {
+			parts[i] = "COUNT=" + strconv.Itoa(count)
+		}
+	}
+	if mod != "" {
+		return rrulePrefix + strings.Join(parts, ";") + " " + mod
+	}
+	return rrulePrefix + strings.Join(parts, ";")
+}
+
+// countBefore возвращает число дат правила, начиная со start, которые раньше end.
+func (r *RRule) countBefore(start, end time.Time) int {
+	n := 0
+	r.each(start, start, func(d time.Time) bool {
+		if !d.Before(end) {
+			return false
+		}
+		n++
+		return true
+	})
+	return n
+}
+
+// each перебирает даты правила по возрастанию и вызывает yield для каждой, пока yield возвращает true.
+// Без COUNT перебор начинается сразу с периода, в который попадает from; с COUNT даты
+// приходится считать от start.
+func (r *RRule) each(start, from time.Time, yield func(time.Time) bool) {
+	k := 0
+	if r.count == 0 && from.After(start) {
+		k = r.periodsBetween(start, from) / r.interval
+	}
+
+	n := 0
+	if k == 0 {
+		if !r.until.IsZero() && start.After(r.until) {
+			return
+		}
+		n++
+		if !yield(start) {
+			return
+		}
+	}
+
+	for empty := 0; empty < maxEmptyPeriods[r.freq]; k++ {
+		days := r.expand(start, r.period(start, k))
+		if len(days) == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+		for _, d := range days {
+			if !d.After(start) {
+				continue
+			}
+			if r.count > 0 && n >= r.count {
+				return
+			}
+			if !r.until.IsZero() && d.After(r.until) {
+				return
+			}
+			n++
+			if !yield(d) {
+				return
+			}
+		}
+	}
+}
+
+// periodStart возвращает начало периода (дня, недели, месяца или года), содержащего t.
+func (r *RRule) periodStart(t time.Time) time.Time {
+	switch r.freq {
+	case weekly:
+		shift := (int(t.Weekday()) - int(r.wkst) + 7) % 7
+		return t.AddDate(0, 0, -shift)
+	case monthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case yearly:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
+
+// periodsBetween возвращает число целых периодов между периодами, содержащими start и t.
+func (r *RRule) periodsBetween(start, t time.Time) int {
+	switch r.freq {
+	case weekly:
+		return daysBetween(r.periodStart(start), r.periodStart(t)) / 7
+	case monthly:
+		return (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+	case yearly:
+		return t.Year() - start.Year()
+	}
+	return daysBetween(start, t)
+}
+
+// period возвращает начало k-го по счёту периода правила с учётом INTERVAL.
+func (r *RRule) period(start time.Time, k int) time.Time {
+	p := r.periodStart(start)
+	step := k * r.interval
+	switch r.freq {
+	case weekly:
+		return p.AddDate(0, 0, 7*step)
+	case monthly:
+		return p.AddDate(0, step, 0)
+	case yearly:
+		return p.AddDate(step, 0, 0)
+	}
+	return p.AddDate(0, 0, step)
+}
+
+// expand возвращает отсортированные даты правила внутри периода, начинающегося с p.
+func (r *RRule) expand(start, p time.Time) []time.Time {
+	var from, to time.Time
+	switch r.freq {
+	case daily:
+		from, to = p, p.AddDate(0, 0, 1)
+	case weekly:
+		from, to = p, p.AddDate(0, 0, 7)
+	case monthly:
+		from, to = p, p.AddDate(0, 1, 0)
+	case yearly:
+		from, to = p, p.AddDate(1, 0, 0)
+	}
+
+	var days []time.Time
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		if r.match(start, d) {
+			days = append(days, d)
+		}
+	}
+	return r.setPos(days)
+}
+
+// match проверяет, подходит ли день d под правило. Параметры BY* либо расширяют
+// период (выбирают дни внутри месяца или года), либо ограничивают его — как
+// в таблице из раздела 3.3.10 RFC 5545.
+func (r *RRule) match(start, d time.Time) bool {
+	if len(r.byMonth) > 0 && !containsMonth(r.byMonth, d.Month()) {
+		return false
+	}
+	if len(r.byMonthDay) > 0 && !matchMonthDay(r.byMonthDay, d) {
+		return false
+	}
+	if len(r.byDay) > 0 && !r.matchByDay(d) {
+		return false
+	}
+
+	switch r.freq {
+	case weekly:
+		if len(r.byDay) == 0 {
+			return d.Weekday() == start.Weekday()
+		}
+	case monthly:
+		if len(r.byDay) == 0 && len(r.byMonthDay) == 0 {
+			return d.Day() == start.Day()
+		}
+	case yearly:
+		if len(r.byDay) == 0 && len(r.byMonthDay) == 0 {
+			if len(r.byMonth) == 0 && d.Month() != start.Month() {
+				return false
+			}
+			return d.Day() == start.Day()
+		}
+	}
+	return true
+}
+
+// matchByDay проверяет BYDAY. Порядковый номер считается внутри месяца, а для
+// YEARLY без BYMONTH — внутри года.
+func (r *RRule) matchByDay(d time.Time) bool {
+	inYear := r.freq == yearly && len(r.byMonth) == 0
+	for _, bd := range r.byDay {
+		if d.Weekday() != bd.weekday {
+			continue
+		}
+		if bd.n == 0 {
+			return true
+		}
+		pos, total := d.Day(), daysIn(d.Year(), d.Month())
+		if inYear {
+			pos, total = d.YearDay(), daysInYear(d.Year())
+		}
+		if bd.n > 0 && (pos-1)/7+1 == bd.n {
+			return true
+		}
+		if bd.n < 0 && (total-pos)/7+1 == -bd.n {
+			return true
+		}
+	}
+	return false
+}
+
+// setPos применяет BYSETPOS к отсортированному набору дат периода.
+func (r *RRule) setPos(days []time.Time) []time.Time {
+	if len(r.bySetPos) == 0 || len(days) == 0 {
+		return days
+	}
+	picked := make(map[int]bool)
+	for _, pos := range r.bySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(days) + pos
+		}
+		if i >= 0 && i < len(days) {
+			picked[i] = true
+		}
+	}
+	var res []time.Time
+	for i, d := range days {
+		if picked[i] {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+func containsMonth(months []time.Month, m time.Month) bool {
+	for _, month := range months {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMonthDay проверяет день месяца; отрицательные значения считаются от конца месяца.
+func matchMonthDay(monthDays []int, d time.Time) bool {
+	last := daysIn(d.Year(), d.Month())
+	for _, md := range monthDays {
+		if md > 0 && d.Day() == md {
+			return true
+		}
+		if md < 0 && d.Day() == last+md+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// daysIn возвращает число дней в месяце.
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// daysInYear возвращает число дней в году.
+func daysInYear(year int) int {
+	return time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+}
@@ -0,0 +1,475 @@
+package nextdate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoOccurrence возвращается, когда у правила повторения не осталось дат (исчерпаны COUNT или UNTIL).
+var ErrNoOccurrence = errors.New("у правила повторения больше нет дат")
+
+// Rule — разобранное правило повторения.
+type Rule interface {
+	// Next возвращает первую дату повторения строго после start и строго после after.
+	// start — дата задачи, от которой отсчитываются повторения; обе даты — полночь UTC
+	// (кроме SubDailyRule, которому нужно и время).
+	Next(start, after time.Time) (time.Time, error)
+	// String возвращает запись правила.
+	String() string
+}
+
+// RuleError описывает ошибку в правиле повторения: какая часть правила неверна и почему.
+type RuleError struct {
+	Rule   string // правило целиком
+	Token  string // неверная часть правила; пустая, если ошибка относится ко всему правилу
+	Reason string
+}
+
+func (e *RuleError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("неверное правило повторения %q: %s", e.Rule, e.Reason)
+	}
+	return fmt.Sprintf("неверное правило повторения %q: %q — %s", e.Rule, e.Token, e.Reason)
+}
+
+func ruleError(token, reason string) *RuleError {
+	return &RuleError{Token: token, Reason: reason}
+}
+
+// ParseRule разбирает правило повторения: короткое (d, w, m, mw, mb, y, h, min) или RRULE,
+// с необязательным модификатором переноса на рабочий день (b+ или b-) в конце.
+// Ошибка разбора всегда имеет тип *RuleError.
+func ParseRule(repeat string) (Rule, error) {
+	rule, err := parseRule(repeat)
+	if err != nil {
+		err.Rule = repeat
+		return nil, err
+	}
+	return rule, nil
+}
+
+func parseRule(repeat string) (Rule, *RuleError) {
+	base, mod := splitModifier(repeat)
+	rule, err := parseBaseRule(base)
+	if err != nil || mod == "" {
+		return rule, err
+	}
+	if isSubDaily(rule) {
+		return nil, ruleError(mod, "перенос на рабочий день не применяется к правилам h и min")
+	}
+	return ShiftedRule{Rule: rule, Backward: mod == shiftBackward}, nil
+}
+
+func parseBaseRule(repeat string) (Rule, *RuleError) {
+	if strings.HasPrefix(repeat, rrulePrefix) {
+		rule, err := parseRRule(repeat)
+		if err != nil {
+			return nil, err.(*RuleError)
+		}
+		return rule, nil
+	}
+
+	fields := strings.Fields(repeat)
+	if len(fields) == 0 {
+		return nil, ruleError("", "пустое правило")
+	}
+
+	switch fields[0] {
+	case "y":
+		if len(fields) > 1 {
+			return nil, ruleError(fields[1], "у правила y не бывает параметров")
+		}
+		return YearlyRule{}, nil
+	case "d":
+		return parseDaily(fields)
+	case "w":
+		return parseWeekly(fields)
+	case "m":
+		return parseMonthly(fields)
+	case "mw":
+		return parseMonthWeekday(fields)
+	case "mb":
+		return parseBusinessDay(fields)
+	case "h", "min":
+		return parseSubDaily(fields)
+	}
+	return nil, ruleError(fields[0], "неизвестный тип правила, ожидается d, w, m, mw, mb, y, h, min или RRULE:")
+}
+
+// YearlyRule — правило "y": ежегодно в тот же день.
+type YearlyRule struct{}
+
+// Next для 29 февраля следует time.AddDate: в невисокосный год дата переходит на 1 марта
+// и дальше остаётся 1 марта.
+func (YearlyRule) Next(start, after time.Time) (time.Time, error) {
+	// Первое повторение никогда не бывает 29 февраля, поэтому от него можно сразу
+	// отложить нужное число лет.
+	first := start.AddDate(1, 0, 0)
+	if first.After(after) {
+		return first, nil
+	}
+	t := first.AddDate(after.Year()-first.Year(), 0, 0)
+	if !t.After(after) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return t, nil
+}
+
+func (YearlyRule) String() string {
+	return "y"
+}
+
+// DailyRule — правило "d N": каждые N дней.
+type DailyRule struct {
+	Interval int
+}
+
+func parseDaily(fields []string) (Rule, *RuleError) {
+	if len(fields) < 2 {
+		return nil, ruleError("", "не указан интервал в днях")
+	}
+	if len(fields) > 2 {
+		return nil, ruleError(fields[2], "лишняя часть правила")
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, ruleError(fields[1], "интервал в днях должен быть числом")
+	}
+	if n < 1 || n > 400 {
+		return nil, ruleError(fields[1], "интервал в днях должен быть от 1 до 400")
+	}
+	return DailyRule{Interval: n}, nil
+}
+
+func (r DailyRule) Next(start, after time.Time) (time.Time, error) {
+	if after.Before(start) {
+		after = start
+	}
+	k := daysBetween(start, after)/r.Interval + 1
+	return start.AddDate(0, 0, k*r.Interval), nil
+}
+
+func (r DailyRule) String() string {
+	return "d " + strconv.Itoa(r.Interval)
+}
+
+// WeeklyRule — правило "w 1,4 [N]": в указанные дни недели (1 — понедельник, 7 — воскресенье),
+// при необходимости только каждую N-ю неделю. Недели начинаются с понедельника и отсчитываются
+// от недели, в которую попадает дата задачи.
+type WeeklyRule struct {
+	Weekdays []time.Weekday
+	Interval int // 0 и 1 — каждую неделю
+}
+
+func parseWeekly(fields []string) (Rule, *RuleError) {
+	if len(fields) < 2 {
+		return nil, ruleError("", "не указаны дни недели")
+	}
+	if len(fields) > 3 {
+		return nil, ruleError(fields[3], "лишняя часть правила")
+	}
+	var r WeeklyRule
+	for _, s := range strings.Split(fields[1], ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 7 {
+			return nil, ruleError(s, "день недели должен быть числом от 1 до 7")
+		}
+		r.Weekdays = append(r.Weekdays, time.Weekday(n%7)) // 7 — воскресенье, в time.Weekday это 0
+	}
+	if len(fields) == 3 {
+		n, err := strconv.Atoi(fields[2])
+		if err != nil || n < 1 || n > 52 {
+			return nil, ruleError(fields[2], "интервал в неделях должен быть числом от 1 до 52")
+		}
+		r.Interval = n
+	}
+	return r, nil
+}
+
+// Next при интервале больше недели сохраняет чётность недель, пока дата задачи сама является
+// датой серии — а DoneTask переносит задачу именно на следующую дату серии.
+func (r WeeklyRule) Next(start, after time.Time) (time.Time, error) {
+	var isWeekDay [7]bool
+	for _, wd := range r.Weekdays {
+		isWeekDay[wd] = true
+	}
+	interval := max(r.Interval, 1)
+	firstWeek := weekStart(start)
+
+	if after.Before(start) {
+		after = start
+	}
+	t := after.AddDate(0, 0, 1)
+	// Сразу переходим к ближайшей неделе серии, а в ней — к нужному дню недели.
+	// Если в этой неделе подходящих дней уже не осталось, то они есть в следующей неделе серии.
+	for i := 0; i < 2; i++ {
+		weeks := daysBetween(firstWeek, weekStart(t)) / 7
+		if skip := (interval - weeks%interval) % interval; skip > 0 {
+			t = weekStart(t).AddDate(0, 0, 7*skip)
+		}
+		for d := t; d.Before(weekStart(t).AddDate(0, 0, 7)); d = d.AddDate(0, 0, 1) {
+			if isWeekDay[d.Weekday()] {
+				return d, nil
+			}
+		}
+		t = weekStart(t).AddDate(0, 0, 7*interval)
+	}
+	return time.Time{}, ErrNoOccurrence
+}
+
+func (r WeeklyRule) String() string {
+	days := make([]string, len(r.Weekdays))
+	for i, wd := range r.Weekdays {
+		days[i] = strconv.Itoa(isoWeekday(wd))
+	}
+	s := "w " + strings.Join(days, ",")
+	if r.Interval > 0 {
+		s += " " + strconv.Itoa(r.Interval)
+	}
+	return s
+}
+
+// daysBetween возвращает число полных суток от a до b. В отличие от b.Sub(a) не переполняется
+// на промежутках больше 292 лет.
+func daysBetween(a, b time.Time) int {
+	return int((b.Unix() - a.Unix()) / (24 * 60 * 60))
+}
+
+// weekStart возвращает понедельник недели, в которую попадает t.
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, 1-isoWeekday(t.Weekday()))
+}
+
+// MonthlyRule — правило "m 1,15 [1,6]": в указанные дни месяца (-1 — последний, -2 — предпоследний),
+// при необходимости только в указанные месяцы.
+type MonthlyRule struct {
+	Days   []int
+	Months []time.Month
+}
+
+func parseMonthly(fields []string) (Rule, *RuleError) {
+	if len(fields) < 2 {
+		return nil, ruleError("", "не указаны дни месяца")
+	}
+	if len(fields) > 3 {
+		return nil, ruleError(fields[3], "лишняя часть правила")
+	}
+
+	var r MonthlyRule
+	for _, s := range strings.Split(fields[1], ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < -2 || n > 31 || n == 0 {
+			return nil, ruleError(s, "день месяца должен быть числом от 1 до 31, -1 или -2")
+		}
+		r.Days = append(r.Days, n)
+	}
+	if len(fields) == 3 {
+		for _, s := range strings.Split(fields[2], ",") {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > 12 {
+				return nil, ruleError(s, "месяц должен быть числом от 1 до 12")
+			}
+			r.Months = append(r.Months, time.Month(n))
+		}
+	}
+
+	for i, day := range r.Days {
+		if !r.dayExists(day) {
+			return nil, ruleError(strings.Split(fields[1], ",")[i], "такого дня нет ни в одном из указанных месяцев")
+		}
+	}
+	return r, nil
+}
+
+// dayExists проверяет, что день встречается хотя бы в одном из месяцев правила.
+func (r MonthlyRule) dayExists(day int) bool {
+	if day < 0 || len(r.Months) == 0 {
+		return true
+	}
+	for _, m := range r.Months {
+		if day <= daysIn(2024, m) { // 2024 — високосный год, у февраля 29 дней
+			return true
+		}
+	}
+	return false
+}
+
+func (r MonthlyRule) Next(start, after time.Time) (time.Time, error) {
+	var isMonth [13]bool
+	for _, m := range r.Months {
+		isMonth[m] = true
+	}
+	if after.Before(start) {
+		after = start
+	}
+
+	// Перебираем месяцы, начиная с месяца after, и в каждом сразу вычисляем нужные дни.
+	// Ищем не дальше 8 лет: за это время обязательно встретится даже 29 февраля.
+	month := time.Date(after.Year(), after.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= 8*12; i, month = i+1, month.AddDate(0, 1, 0) {
+		if len(r.Months) > 0 && !isMonth[month.Month()] {
+			continue
+		}
+		last := daysIn(month.Year(), month.Month())
+		var found time.Time
+		for _, day := range r.Days {
+			if day < 0 {
+				day = last + 1 + day
+			}
+			if day > last {
+				continue
+			}
+			d := month.AddDate(0, 0, day-1)
+			if d.After(after) && (found.IsZero() || d.Before(found)) {
+				found = d
+			}
+		}
+		if !found.IsZero() {
+			return found, nil
+		}
+	}
+	return time.Time{}, ErrNoOccurrence
+}
+
+func (r MonthlyRule) String() string {
+	s := "m " + joinInts(r.Days)
+	if len(r.Months) > 0 {
+		months := make([]int, len(r.Months))
+		for i, m := range r.Months {
+			months[i] = int(m)
+		}
+		s += " " + joinInts(months)
+	}
+	return s
+}
+
+// MonthWeekdayRule — правило "mw 2 2 [1,6]": в N-й день недели месяца (здесь — во второй вторник).
+// Первый параметр — дни недели (1 — понедельник, 7 — воскресенье), второй — их номера в месяце
+// от 1 до 5 или от -1 (последний) до -5, третий — при необходимости месяцы.
+type MonthWeekdayRule struct {
+	Weekdays  []time.Weekday
+	Positions []int
+	Months    []time.Month
+}
+
+func parseMonthWeekday(fields []string) (Rule, *RuleError) {
+	if len(fields) < 2 {
+		return nil, ruleError("", "не указаны дни недели")
+	}
+	if len(fields) < 3 {
+		return nil, ruleError("", "не указаны номера дней недели в месяце")
+	}
+	if len(fields) > 4 {
+		return nil, ruleError(fields[4], "лишняя часть правила")
+	}
+
+	var r MonthWeekdayRule
+	for _, s := range strings.Split(fields[1], ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 7 {
+			return nil, ruleError(s, "день недели должен быть числом от 1 до 7")
+		}
+		r.Weekdays = append(r.Weekdays, time.Weekday(n%7))
+	}
+	for _, s := range strings.Split(fields[2], ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < -5 || n > 5 || n == 0 {
+			return nil, ruleError(s, "номер дня недели в месяце должен быть от 1 до 5 или от -1 до -5")
+		}
+		r.Positions = append(r.Positions, n)
+	}
+	if len(fields) == 4 {
+		for _, s := range strings.Split(fields[3], ",") {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > 12 {
+				return nil, ruleError(s, "месяц должен быть числом от 1 до 12")
+			}
+			r.Months = append(r.Months, time.Month(n))
+		}
+	}
+	return r, nil
+}
+
+func (r MonthWeekdayRule) Next(start, after time.Time) (time.Time, error) {
+	var isMonth [13]bool
+	for _, m := range r.Months {
+		isMonth[m] = true
+	}
+	if start.After(after) {
+		after = start
+	}
+
+	// Пятый день недели бывает не в каждом месяце (пятый понедельник февраля — раз в несколько
+	// десятилетий), поэтому перебираем месяцы за полный 400-летний цикл календаря.
+	month := time.Date(after.Year(), after.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4800; i, month = i+1, month.AddDate(0, 1, 0) {
+		if len(r.Months) > 0 && !isMonth[month.Month()] {
+			continue
+		}
+		var found time.Time
+		for _, wd := range r.Weekdays {
+			for _, n := range r.Positions {
+				d, ok := nthWeekday(month.Year(), month.Month(), wd, n)
+				if ok && d.After(after) && (found.IsZero() || d.Before(found)) {
+					found = d
+				}
+			}
+		}
+		if !found.IsZero() {
+			return found, nil
+		}
+	}
+	return time.Time{}, ErrNoOccurrence
+}
+
+func (r MonthWeekdayRule) String() string {
+	days := make([]int, len(r.Weekdays))
+	for i, wd := range r.Weekdays {
+		days[i] = isoWeekday(wd)
+	}
+	s := "mw " + joinInts(days) + " " + joinInts(r.Positions)
+	if len(r.Months) > 0 {
+		months := make([]int, len(r.Months))
+		for i, m := range r.Months {
+			months[i] = int(m)
+		}
+		s += " " + joinInts(months)
+	}
+	return s
+}
+
+// nthWeekday возвращает n-й день недели wd в месяце; отрицательное n считается от конца месяца.
+func nthWeekday(year int, month time.Month, wd time.Weekday, n int) (time.Time, bool) {
+	last := daysIn(year, month)
+	var day int
+	if n > 0 {
+		first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+		day = 1 + (int(wd)-int(first)+7)%7 + 7*(n-1)
+	} else {
+		lastWd := time.Date(year, month, last, 0, 0, 0, 0, time.UTC).Weekday()
+		day = last - (int(lastWd)-int(wd)+7)%7 + 7*(n+1)
+	}
+	if day < 1 || day > last {
+		return time.Time{}, false
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), true
+}
+
+// isoWeekday переводит time.Weekday в номер дня недели правил: 1 — понедельник, 7 — воскресенье.
+func isoWeekday(wd time.Weekday) int {
+	if wd == time.Sunday {
+		return 7
+	}
+	return int(wd)
+}
+
+func joinInts(list []int) string {
+	s := make([]string, len(list))
+	for i, n := range list {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,59 @@
+package nextdate
+
+import (
+	"strconv"
+	"time"
+)
+
+// SubDailyRule — правила "h N" и "min N": каждые N часов или минут. Повторения отсчитываются
+// от даты и времени задачи; у задачи без времени — от полуночи.
+type SubDailyRule struct {
+	Interval int
+	Unit     time.Duration // time.Hour или time.Minute
+}
+
+func parseSubDaily(fields []string) (Rule, *RuleError) {
+	unit, name, limit := time.Hour, "часах", 24
+	if fields[0] == "min" {
+		unit, name, limit = time.Minute, "минутах", 1440
+	}
+	if len(fields) < 2 {
+		return nil, ruleError("", "не указан интервал в "+name)
+	}
+	if len(fields) > 2 {
+		return nil, ruleError(fields[2], "лишняя часть правила")
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 1 || n > limit {
+		return nil, ruleError(fields[1], "интервал в "+name+" должен быть числом от 1 до "+strconv.Itoa(limit))
+	}
+	return SubDailyRule{Interval: n, Unit: unit}, nil
+}
+
+// Next возвращает первый слот строго после start и after. Здесь start и after — не только даты,
+// но и время: start — дата и время задачи, after — показания часов пользователя.
+func (r SubDailyRule) Next(start, after time.Time) (time.Time, error) {
+	step := int64(time.Duration(r.Interval) * r.Unit / time.Second)
+	if after.Before(start) {
+		return start.Add(time.Duration(step) * time.Second), nil
+	}
+	// Считаем в секундах: промежуток в сотни лет не помещается в time.Duration.
+	k := (after.Unix()-start.Unix())/step + 1
+	return time.Unix(start.Unix()+k*step, 0).UTC(), nil
+}
+
+func (r SubDailyRule) String() string {
+	if r.Unit == time.Minute {
+		return "min " + strconv.Itoa(r.Interval)
+	}
+	return "h " + strconv.Itoa(r.Interval)
+}
+
+// isSubDaily сообщает, повторяется ли правило чаще раза в день.
+func isSubDaily(rule Rule) bool {
+	if limited, ok := rule.(LimitedRule); ok {
+		rule = limited.Rule
+	}
+	_, ok := rule.(SubDailyRule)
+	return ok
+}
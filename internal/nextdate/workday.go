@@ -0,0 +1,177 @@
+package nextdate
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Модификаторы правила: дата, выпавшая на выходной или праздник, переносится
+// на следующий (b+) или предыдущий (b-) рабочий день. Модификатор пишется
+// последней частью правила через пробел: "m 15 b-", "RRULE:FREQ=MONTHLY;BYMONTHDAY=1 b+".
+const (
+	shiftForward  = "b+"
+	shiftBackward = "b-"
+)
+
+// maxShift — насколько дней перенос может сдвинуть дату. Его хватает с запасом
+// даже на длинные новогодние каникулы.
+const maxShift = 31
+
+// splitModifier отделяет модификатор переноса от основного правила.
+func splitModifier(repeat string) (string, string) {
+	repeat = strings.TrimSpace(repeat)
+	i := strings.LastIndexByte(repeat, ' ')
+	if i < 0 {
+		return repeat, ""
+	}
+	if mod := repeat[i+1:]; mod == shiftForward || mod == shiftBackward {
+		return strings.TrimSpace(repeat[:i]), mod
+	}
+	return repeat, ""
+}
+
+// ShiftedRule — правило, даты которого переносятся с выходных и праздников на рабочие дни.
+// Перенос применяется к уже вычисленной дате основного правила, а повторения отсчитываются
+// от даты основного правила: start — дата серии до переноса, иначе перенос сдвигал бы всю серию
+// (правило "y b+" с 1 января переходило бы на 2 января). Complete возвращает эту дату вместе
+// с перенесённой.
+type ShiftedRule struct {
+	Rule
+	Backward bool // переносить на предыдущий рабочий день, а не на следующий
+}
+
+func (r ShiftedRule) Next(start, after time.Time) (time.Time, error) {
+	_, shifted, err := r.next(start, after)
+	return shifted, err
+}
+
+// next возвращает первую дату основного правила, которая после переноса оказывается позже start
+// и позже after, и эту же дату после переноса.
+func (r ShiftedRule) next(start, after time.Time) (time.Time, time.Time, error) {
+	step := 1
+	if r.Backward {
+		step = -1
+	}
+	// Перенос может сдвинуть дату через after в любую сторону, поэтому даты основного
+	// правила перебираются начиная чуть раньше after.
+	cursor := after.AddDate(0, 0, -maxShift)
+	if cursor.Before(start) {
+		cursor = start
+	}
+	for i := 0; i < 10000; i++ {
+		raw, err := r.Rule.Next(start, cursor)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		shifted, ok := calendar.shiftToWorkday(raw, step)
+		if !ok {
+			return time.Time{}, time.Time{}, ErrNoOccurrence
+		}
+		if shifted.After(after) && shifted.After(start) {
+			return raw, shifted, nil
+		}
+		cursor = raw
+	}
+	return time.Time{}, time.Time{}, ErrNoOccurrence
+}
+
+func (r ShiftedRule) String() string {
+	if r.Backward {
+		return r.Rule.String() + " " + shiftBackward
+	}
+	return r.Rule.String() + " " + shiftForward
+}
+
+// BusinessDayRule — правило "mb 3 [1,6]": N-й рабочий день месяца, -1 — последний рабочий день.
+// Рабочие дни считаются по календарю, заданному SetCalendar.
+type BusinessDayRule struct {
+	Positions []int
+	Months    []time.Month
+}
+
+func parseBusinessDay(fields []string) (Rule, *RuleError) {
+	if len(fields) < 2 {
+		return nil, ruleError("", "не указаны номера рабочих дней")
+	}
+	if len(fields) > 3 {
+		return nil, ruleError(fields[3], "лишняя часть правила")
+	}
+
+	var r BusinessDayRule
+	for _, s := range strings.Split(fields[1], ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < -23 || n > 23 || n == 0 {
+			return nil, ruleError(s, "номер рабочего дня должен быть от 1 до 23 или от -1 до -23")
+		}
+		r.Positions = append(r.Positions, n)
+	}
+	if len(fields) == 3 {
+		for _, s := range strings.Split(fields[2], ",") {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > 12 {
+				return nil, ruleError(s, "месяц должен быть числом от 1 до 12")
+			}
+			r.Months = append(r.Months, time.Month(n))
+		}
+	}
+	return r, nil
+}
+
+func (r BusinessDayRule) Next(start, after time.Time) (time.Time, error) {
+	var isMonth [13]bool
+	for _, m := range r.Months {
+		isMonth[m] = true
+	}
+	if start.After(after) {
+		after = start
+	}
+
+	month := time.Date(after.Year(), after.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4800; i, month = i+1, month.AddDate(0, 1, 0) {
+		if len(r.Months) > 0 && !isMonth[month.Month()] {
+			continue
+		}
+		workdays := monthWorkdays(month)
+		var found time.Time
+		for _, n := range r.Positions {
+			i := n - 1
+			if n < 0 {
+				i = len(workdays) + n
+			}
+			if i < 0 || i >= len(workdays) {
+				continue
+			}
+			if d := workdays[i]; d.After(after) && (found.IsZero() || d.Before(found)) {
+				found = d
+			}
+		}
+		if !found.IsZero() {
+			return found, nil
+		}
+	}
+	return time.Time{}, ErrNoOccurrence
+}
+
+func (r BusinessDayRule) String() string {
+	s := "mb " + joinInts(r.Positions)
+	if len(r.Months) > 0 {
+		months := make([]int, len(r.Months))
+		for i, m := range r.Months {
+			months[i] = int(m)
+		}
+		s += " " + joinInts(months)
+	}
+	return s
+}
+
+// monthWorkdays возвращает рабочие дни месяца, начинающегося с month, по порядку.
+func monthWorkdays(month time.Time) []time.Time {
+	var days []time.Time
+	for d := month; d.Month() == month.Month(); d = d.AddDate(0, 0, 1) {
+		if calendar.IsWorkday(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
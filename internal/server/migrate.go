@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vova4o/go_final_project/internal/config"
+	"github.com/vova4o/go_final_project/internal/database"
+)
+
+// Migrate проверяет (mode = "check") или применяет (mode = "up") миграции базы данных, не запуская HTTP-сервер.
+// В режиме check возвращает ошибку, если есть неприменённые миграции.
+func Migrate(mode string) error {
+	if mode != "check" && mode != "up" {
+		return fmt.Errorf("режим миграций %q не поддерживается, доступны check и up", mode)
+	}
+
+	if config.DB() == config.Memory {
+		log.Println("Tasks are kept in memory, there is nothing to migrate")
+		return nil
+	}
+
+	// Проверка только читает базу данных и не создаёт её, если базы ещё нет.
+	open := database.Open
+	if mode == "check" {
+		open = database.OpenReadOnly
+	}
+	storage, err := open()
+	if err != nil {
+		return err
+	}
+	defer storage.CloseDB()
+
+	if mode == "up" {
+		if err := storage.Migrate(); err != nil {
+			return err
+		}
+	}
+
+	states, err := storage.Migrations()
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, m := range states {
+		status := "applied"
+		if !m.Applied {
+			status = "pending"
+			pending++
+		}
+		log.Printf("Migration %d %s: %s\n", m.Version, m.Name, status)
+	}
+	if pending > 0 {
+		return fmt.Errorf("не применено миграций: %d", pending)
+	}
+	return nil
+}
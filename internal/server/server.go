@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"time"
+	_ "time/tzdata" // база часовых поясов нужна в контейнере, где её нет в системе
 
 	"github.com/gin-gonic/gin"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/vova4o/go_final_project/internal/database"
 	"github.com/vova4o/go_final_project/internal/handlers"
 	"github.com/vova4o/go_final_project/internal/logger"
+	"github.com/vova4o/go_final_project/internal/nextdate"
 )
 
 type ServerConfig struct {
@@ -21,16 +24,41 @@ type ServerConfig struct {
 	Handler *gin.Engine
 	Storage handlers.Storager
 	Log     *logger.Logger
+
+	server *http.Server
+	// ctx — базовый контекст запросов; stop отменяет его, прерывая запросы к хранилищу, которые не успели завершиться при остановке.
+	ctx  context.Context
+	stop context.CancelFunc
 }
 
 func NewApp() *ServerConfig {
 	addr := config.Address()
 
-	storage, err := database.New()
+	storage, err := newStorage()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if path := config.HolidaysPath(); path != "" {
+		calendar, err := nextdate.LoadCalendar(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		nextdate.SetCalendar(calendar)
+		log.Printf("Holiday calendar: %s\n", path)
+	}
+
+	if name := config.Timezone(); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		handlers.SetLocation(loc)
+		log.Printf("Time zone: %s\n", name)
+	}
+
+	handlers.SetDBTimeout(config.DBTimeout())
+
 	log := logger.New()
 
 	gin.SetMode(gin.ReleaseMode)
@@ -44,25 +72,45 @@ func NewApp() *ServerConfig {
 
 	handler.Use(log.GinLogger())
 
+	ctx, stop := context.WithCancel(context.Background())
+
 	return &ServerConfig{
 		Addr:    addr,
 		Handler: handler,
 		Storage: storage,
 		Log:     log,
+		ctx:     ctx,
+		stop:    stop,
 	}
 }
 
+// newStorage возвращает хранилище задач, выбранное в config.DB(): в памяти или в базе данных.
+func newStorage() (handlers.Storager, error) {
+	if config.DB() == config.Memory {
+		log.Println("Database: memory")
+		return database.NewMemory(), nil
+	}
+	return database.New()
+}
+
+// NewServer возвращает HTTP-сервер приложения; повторные вызовы возвращают тот же сервер.
 func (c *ServerConfig) NewServer() *http.Server {
-	return &http.Server{
-		Addr:    c.Addr,
-		Handler: c.Handler,
+	if c.server == nil {
+		c.server = &http.Server{
+			Addr:        c.Addr,
+			Handler:     c.Handler,
+			BaseContext: func(net.Listener) context.Context { return c.ctx },
+		}
 	}
+	return c.server
 }
 
 func (c *ServerConfig) StartServer() {
+	srv := c.NewServer()
+	c.startTrashPurge(config.TrashRetention())
 	go func() {
 		log.Printf("Starting server on %s\n", c.Addr)
-		if err := c.NewServer().ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
@@ -77,8 +125,10 @@ func (c *ServerConfig) ShutdownServer(srv *http.Server) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		log.Println("Server forced to shutdown:", err)
 	}
+	// Запросы, которые не завершились за отведённое время, прерываются вместе с их запросами к хранилищу.
+	c.stop()
 
 	c.Storage.CloseDB()
 
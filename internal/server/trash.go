@@ -0,0 +1,38 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+// purgeTrashEvery — как часто из корзины удаляются задачи, которые пролежали в ней дольше срока хранения.
+const purgeTrashEvery = time.Hour
+
+// startTrashPurge при запуске и затем каждый час удаляет навсегда задачи, пролежавшие в корзине дольше retention,
+// пока сервер не остановится. Нулевой retention означает, что задачи хранятся в корзине, пока их не удалят вручную.
+func (c *ServerConfig) startTrashPurge(retention time.Duration) {
+	if retention <= 0 {
+		log.Println("Deleted tasks are kept in the trash until it is emptied")
+		return
+	}
+	log.Printf("Deleted tasks are kept in the trash for %s\n", retention)
+
+	go func() {
+		ticker := time.NewTicker(purgeTrashEvery)
+		defer ticker.Stop()
+		for {
+			n, err := c.Storage.PurgeTrash(c.ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Println("Trash purge failed:", err)
+			} else if n > 0 {
+				log.Printf("Purged %d tasks from the trash\n", n)
+			}
+
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
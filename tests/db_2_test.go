@@ -11,11 +11,17 @@ import (
 )
 
 type Task struct {
-	ID      int64  `db:"id"`
-	Date    string `db:"date"`
-	Title   string `db:"title"`
-	Comment string `db:"comment"`
-	Repeat  string `db:"repeat"`
+	ID         int64  `db:"id"`
+	Date       string `db:"date"`
+	Time       string `db:"time"`
+	Title      string `db:"title"`
+	Comment    string `db:"comment"`
+	Repeat     string `db:"repeat"`
+	Anchor     string `db:"anchor"`
+	EndDate    string `db:"end_date"`
+	MaxCount   int    `db:"max_count"`
+	DoneCount  int    `db:"done_count"`
+	SeriesDate string `db:"series_date"`
 }
 
 func count(db *sqlx.DB) (int, error) {